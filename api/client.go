@@ -7,10 +7,15 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"golang.org/x/crypto/pbkdf2"
@@ -22,9 +27,13 @@ import (
 const URL = "wss://fhome.cloud/webapp-interface/"
 
 type Client struct {
+	url string
+
 	email                *string
+	password             *string
 	resourcePasswordHash *string
 	uniqueID             *string
+	resources            []Resource
 
 	dialer *websocket.Dialer
 
@@ -33,163 +42,267 @@ type Client struct {
 	//  - get_my_data
 	//  - get_my_resources actions
 	setupConn *websocket.Conn
+	// Guards use of setupConn after the resource session is open.
+	setupMu sync.Mutex
 
 	// The second connection that is used for all other actions.
 	mainConn *websocket.Conn
+	// Guards writes to mainConn, replacing connections, connected and
+	// broken.
+	writeMu sync.Mutex
+	// Whether mainConn is usable.
+	connected bool
+	// Why mainConn was closed by the client, see breakConn.
+	broken error
+
+	reconnect     *ReconnectPolicy
+	onStateChange func(state ConnState, err error)
+
+	keepalive     *KeepalivePolicy
+	keepaliveOnce sync.Once
+	// Unix time in nanoseconds of the last message read from mainConn.
+	lastMessageAt atomic.Int64
+	// Round-trip time of the last ping.
+	rtt atomic.Int64
+
+	// Guards closed, err, pending and subscribers.
+	mu     sync.Mutex
+	closed bool
+	// Why the session ended.
+	err error
+	// Closed when the session ends.
+	done chan struct{}
+	// Requests waiting for a response, keyed by request token.
+	pending map[string]chan Message
+	// Receivers of all messages that are not a response to a pending request.
+	subscribers map[chan Message]struct{}
+
+	// Unsolicited messages read by ReadMessage and ReadAnyMessage.
+	pushes chan Message
+
+	// Guards readOnly.
+	permMu sync.RWMutex
+	// IDs of read-only cells, recorded from the system config.
+	readOnly map[int]struct{}
+
+	// Guards sessionStatus.
+	statusMu sync.Mutex
+	// Response to the check of the resource password, see
+	// TakeSessionStatus.
+	sessionStatus *StatusTouchesChangedResponse
+}
+
+// Option configures a [Client] created with [NewClient].
+type Option func(*Client)
 
-	msgStreams map[int]chan<- Message
+// WithURL makes the client dial url instead of [URL].
+//
+// Both wss:// and ws:// URLs are accepted, so the client can talk to a
+// staging proxy or to a fake server in tests.
+func WithURL(url string) Option {
+	return func(c *Client) {
+		c.url = url
+	}
 }
 
-// NewClient returns a new F&Home API client.
+// NewClient returns a new F&Home API client connected to F&Home Cloud.
 //
 // If a nil dialer is provided, a default dialer from gorilla/websocket will be
-// used.
-func NewClient(dialer *websocket.Dialer) (*Client, error) {
+// used. The ctx bounds dialing only, it doesn't affect the returned client.
+func NewClient(ctx context.Context, dialer *websocket.Dialer, opts ...Option) (*Client, error) {
 	if dialer == nil {
 		dialer = websocket.DefaultDialer
 	}
 
-	conn, err := connect(dialer)
-	if err != nil {
-		return nil, fmt.Errorf("connect: %v", err)
-	}
-
-	var response Response
-	err = conn.ReadJSON(&response)
-	if err != nil {
-		return nil, fmt.Errorf("read json response: %v", err)
-	}
-
-	if response.ActionName != "authentication_required" || response.Status != "" {
-		return nil, fmt.Errorf("wrong first message received")
-	}
-
+	policy := DefaultReconnectPolicy
+	keepalive := DefaultKeepalivePolicy
 	c := Client{
+		url:                  URL,
 		email:                nil,
+		password:             nil,
 		resourcePasswordHash: nil,
 		uniqueID:             nil,
 		dialer:               dialer,
-		setupConn:            conn,
+		setupConn:            nil,
 		mainConn:             nil,
-		msgStreams:           make(map[int]chan<- Message),
+		reconnect:            &policy,
+		keepalive:            &keepalive,
+		done:                 make(chan struct{}),
+		pending:              make(map[string]chan Message),
+		subscribers:          make(map[chan Message]struct{}),
+	}
+	c.pushes, _ = c.subscribe(pushesBufferSize)
+
+	for _, opt := range opts {
+		opt(&c)
 	}
 
+	conn, err := c.dialSetup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setupConn = conn
+
 	return &c, nil
 }
 
 // OpenCloudSession opens a websocket connection to F&Home Cloud.
-func (c *Client) OpenCloudSession(email, password string) error {
-	token := generateRequestToken()
+func (c *Client) OpenCloudSession(ctx context.Context, email, password string) error {
+	c.setupMu.Lock()
+	defer c.setupMu.Unlock()
 
-	actionName := ActionOpenClientSession
-	err := c.setupConn.WriteJSON(OpenClientSession{
-		ActionName:   actionName,
-		Email:        email,
-		Password:     password,
-		RequestToken: token,
-	})
+	err := openClientSession(ctx, c.setupConn, email, password)
 	if err != nil {
-		return fmt.Errorf("failed to write %s: %v", actionName, err)
+		return err
 	}
 
-	for {
-		var response Response
-		err = c.setupConn.ReadJSON(&response)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %v", err)
-		}
+	c.email = &email
+	c.password = &password
 
-		if response.Status != "ok" {
-			return fmt.Errorf("response status is %#v", response.Status)
-		}
+	return nil
+}
 
-		if response.RequestToken != token || response.ActionName != actionName {
-			continue
-		}
+// GetMyResources gets resources assigned to the user.
+//
+// Most of the time, there will be just one resource. The first resource is
+// selected, use [Client.SelectResource] to select another one.
+func (c *Client) GetMyResources(ctx context.Context) (*GetMyResourcesResponse, error) {
+	c.setupMu.Lock()
+	defer c.setupMu.Unlock()
 
-		c.email = &email
-		// c.resourcePasswordHash = generatePasswordHash(password)
+	response, err := getMyResources(ctx, c.setupConn, *c.email)
+	if err != nil {
+		return nil, err
+	}
 
-		return nil
+	if len(response.Resources) == 0 {
+		return nil, fmt.Errorf("user %s has no resources", *c.email)
 	}
+
+	c.resources = response.Resources
+	c.uniqueID = &response.Resources[0].UniqueID
+
+	return response, nil
 }
 
-// GetMyResources gets resources assigned to the user.
+// SelectResource selects the resource that [Client.OpenResourceSession] opens
+// a session to.
 //
-// Most of the time, there will be just one resource.
-// Currently, we handle only this case and assign its unique ID to the client.
-func (c *Client) GetMyResources() (*GetMyResourcesResponse, error) {
+// The resource is matched by its unique ID or, case-insensitively, by its
+// friendly name. It must be called after [Client.GetMyResources].
+func (c *Client) SelectResource(resource string) (*Resource, error) {
+	for i := range c.resources {
+		r := &c.resources[i]
+		if r.UniqueID == resource || strings.EqualFold(r.FriendlyName, resource) {
+			c.uniqueID = &r.UniqueID
+			return r, nil
+		}
+	}
+
+	names := make([]string, 0, len(c.resources))
+	for _, r := range c.resources {
+		names = append(names, fmt.Sprintf("%q (%s)", r.FriendlyName, r.UniqueID))
+	}
+
+	return nil, fmt.Errorf("no resource %q, available resources: %s", resource, strings.Join(names, ", "))
+}
+
+// GetMyData returns information about the account of the user.
+func (c *Client) GetMyData(ctx context.Context) (*GetMyDataResponse, error) {
+	c.setupMu.Lock()
+	defer c.setupMu.Unlock()
+
+	actionName := ActionGetMyData
 	token := generateRequestToken()
 
-	actionName := ActionGetMyResources
-	err := c.setupConn.WriteJSON(GetMyResources{
+	var response GetMyDataResponse
+	err := handshake(ctx, c.setupConn, actionName, token, GetMyData{
 		ActionName:   actionName,
 		Email:        *c.email,
 		RequestToken: token,
-	})
+	}, &response)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write action %s: %v", actionName, err)
+		return nil, err
 	}
 
-	for {
-		var response GetMyResourcesResponse
-		err = c.setupConn.ReadJSON(&response)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %v", err)
-		}
-
-		if response.Status != "ok" {
-			return nil, fmt.Errorf("response status is %s", response.Status)
-		}
-
-		if response.RequestToken != token || response.ActionName != actionName {
-			continue
-		}
-
-		c.uniqueID = &response.UniqueID0
-
-		return &response, nil
-	}
+	return &response, nil
 }
 
-// OpenResourceSession open a websocket connection to the only resource that the
-// user has.
+// OpenResourceSession opens a websocket connection to the selected resource.
+//
+// The resource only checks its password when an action uses it, so it's checked
+// here with "statustouches". See [StatusError] for when a failure matches
+// [ErrAuthentication]. The response has the live state of all cells, so it's
+// kept for [Client.TakeSessionStatus].
 //
-// Currently, it assumes that a user has only one resource.
+// See [Client.GetMyResources] and [Client.SelectResource].
 func (c *Client) OpenResourceSession(ctx context.Context, resourcePassword string) error {
 	// We can't reuse the connection previously used to connect to Cloud.
-	conn, err := connect(c.dialer)
+	conn, err := connect(ctx, c.dialer, c.url)
 	if err != nil {
-		return fmt.Errorf("reconnect: %v", err)
+		return fmt.Errorf("reconnect: %w", err)
 	}
 
+	c.writeMu.Lock()
 	c.mainConn = conn
+	c.connected = true
+	c.broken = nil
+	c.writeMu.Unlock()
+	c.watchConn(conn)
+	go c.reader()
 
 	actionName := ActionOpenClienToResourceSession
 	token := generateRequestToken()
 
-	err = c.mainConn.WriteJSON(OpenClientToResourceSession{
+	_, err = c.request(ctx, actionName, token, OpenClientToResourceSession{
 		ActionName:   actionName,
 		Email:        *c.email,
 		UniqueID:     *c.uniqueID,
 		RequestToken: token,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to write %s: %v", actionName, err)
+		return fmt.Errorf("failed to open %s: %w", actionName, err)
 	}
 
-	go c.reader()
+	c.resourcePasswordHash = generatePasswordHash(resourcePassword)
 
-	_, err = c.ReadMessage(ctx, actionName, token)
+	msg, err := c.SendAction(ctx, ActionStatusTouches)
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %v", actionName, err)
+		return fmt.Errorf("failed to check resource password: %w", err)
 	}
 
-	c.resourcePasswordHash = generatePasswordHash(resourcePassword)
+	var status StatusTouchesChangedResponse
+	err = json.Unmarshal(msg.Raw, &status)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal %s response: %w", ActionStatusTouches, err)
+	}
+
+	c.statusMu.Lock()
+	c.sessionStatus = &status
+	c.statusMu.Unlock()
+
+	if c.keepalive != nil {
+		c.keepaliveOnce.Do(func() { go c.keepaliveLoop() })
+	}
 
 	return nil
 }
 
+// TakeSessionStatus returns the response to the "statustouches" request that
+// [Client.OpenResourceSession] sent to check the resource password, so that
+// callers that need the live state right after connecting don't have to send
+// another one. It returns nil if there's no such response or if it was already
+// taken, so that it's never used once it's stale.
+func (c *Client) TakeSessionStatus() *StatusTouchesChangedResponse {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	status := c.sessionStatus
+	c.sessionStatus = nil
+	return status
+}
+
 // GetSystemConfig returns additional information about particular cells, e.g.,
 // their style (icon) and configurator-set name.
 //
@@ -200,30 +313,59 @@ func (c *Client) GetSystemConfig(ctx context.Context) (*TouchesResponse, error)
 	actionName := ActionGetSystemConfig
 	token := generateRequestToken()
 
-	err := c.mainConn.WriteJSON(Action{
+	msg, err := c.request(ctx, actionName, token, Action{
 		ActionName:   actionName,
 		Login:        *c.email,
 		PasswordHash: *c.resourcePasswordHash,
 		RequestToken: token,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to write %s: %v", actionName, err)
-	}
-
-	msg, err := c.ReadMessage(ctx, actionName, token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read message: %v", err)
+		return nil, fmt.Errorf("failed to request %s: %w", actionName, err)
 	}
 
 	var response TouchesResponse
 	err = json.Unmarshal(msg.Raw, &response)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
 	}
 
+	c.RecordPermissions(&response)
+
 	return &response, nil
 }
 
+// RecordPermissions remembers which cells are read-only, so that
+// [Client.SendEvent] can reject writes to them.
+//
+// It's called by [Client.GetSystemConfig]. Call it directly when the system
+// config comes from elsewhere, e.g. from a cache.
+func (c *Client) RecordPermissions(response *TouchesResponse) {
+	readOnly := make(map[int]struct{})
+	for _, cell := range response.Response.MobileDisplayProperties.Cells {
+		if Permission(cell.Permission) != PermissionReadOnly {
+			continue
+		}
+
+		id, err := strconv.Atoi(cell.ID)
+		if err != nil {
+			continue
+		}
+		readOnly[id] = struct{}{}
+	}
+
+	c.permMu.Lock()
+	c.readOnly = readOnly
+	c.permMu.Unlock()
+}
+
+func (c *Client) isReadOnly(cellID int) bool {
+	c.permMu.RLock()
+	defer c.permMu.RUnlock()
+
+	_, ok := c.readOnly[cellID]
+	return ok
+}
+
 // GetUserConfig returns the configuration of cells and panels.
 //
 // The configuration returned by this method is set in the web or mobile app.
@@ -231,31 +373,26 @@ func (c *Client) GetUserConfig(ctx context.Context) (*UserConfig, error) {
 	token := generateRequestToken()
 
 	actionName := ActionGetUserConfig
-	err := c.mainConn.WriteJSON(Action{
+	msg, err := c.request(ctx, actionName, token, Action{
 		ActionName:   actionName,
 		Login:        *c.email,
 		PasswordHash: *c.resourcePasswordHash,
 		RequestToken: token,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to write %s to conn: %v", actionName, err)
-	}
-
-	msg, err := c.ReadMessage(ctx, actionName, token)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read messagee: %v", err)
+		return nil, fmt.Errorf("failed to request %s: %w", actionName, err)
 	}
 
 	var userConfigResponse GetUserConfigResponse
 	err = json.Unmarshal(msg.Raw, &userConfigResponse)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal user config response to json: %v", err)
+		return nil, fmt.Errorf("unmarshal user config response to json: %w", err)
 	}
 
 	var userConfig UserConfig
 	err = json.Unmarshal([]byte(userConfigResponse.File), &userConfig)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal file to json: %v", err)
+		return nil, fmt.Errorf("unmarshal file to json: %w", err)
 	}
 
 	return &userConfig, nil
@@ -265,50 +402,44 @@ func (c *Client) GetUserConfig(ctx context.Context) (*UserConfig, error) {
 // and requestToken.
 //
 // If requestToken is empty, then it is ignored.
-// In such a case, the first message with the matching actionName is returned.
+// In such a case, the first unsolicited message with the matching actionName
+// is returned and all unsolicited messages received before it are discarded.
+//
+// If requestToken is not empty, the response must not have been received yet.
+// Use the request methods of [Client] to avoid races.
 //
-// If its status is not "ok", it returns an error.
+// If its status is not "ok", it returns a [*StatusError].
 func (c *Client) ReadMessage(ctx context.Context, actionName string, requestToken string) (*Message, error) {
+	if requestToken != "" {
+		response := c.register(requestToken)
+		defer c.unregister(requestToken)
+
+		return c.wait(ctx, response)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, fmt.Errorf("context is done")
-		case msg := <-c.read():
-			if msg.Status != nil {
-				if *msg.Status != "ok" {
-					return nil, fmt.Errorf("message status is %s", *msg.Status)
-				}
-			}
-
-			tokenOk := true
-			if requestToken != "" {
-				if msg.RequestToken == nil {
-					tokenOk = false
-				} else if requestToken != *msg.RequestToken {
-					tokenOk = false
-				}
-			}
-
-			if actionName == msg.ActionName && tokenOk {
-				return &msg, nil
+			return nil, fmt.Errorf("waiting for %s: %w", actionName, contextError(ctx))
+		case <-c.done:
+			return nil, c.Err()
+		case msg := <-c.pushes:
+			if msg.ActionName == actionName {
+				return checkStatus(&msg)
 			}
 		}
 	}
 }
 
-// ReadAnyMessage returns any message received from the server.
+// ReadAnyMessage returns any unsolicited message received from the server.
 //
-// If the message has status and it is not ok, it returns an error.
-func (c *Client) ReadAnyMessage() (*Message, error) {
-	msg := <-c.read()
-
-	if msg.Status != nil {
-		if *msg.Status != "ok" {
-			return nil, fmt.Errorf("message status is %s", *msg.Status)
-		}
-	}
-
-	return &msg, nil
+// Messages are buffered, so no messages are lost between two calls, unless the
+// caller falls far behind.
+//
+// If the message has status and it is not ok, it returns an error. If the
+// session ends, it returns the reason, see [Client.Err].
+func (c *Client) ReadAnyMessage(ctx context.Context) (*Message, error) {
+	return c.wait(ctx, c.pushes)
 }
 
 // SendAction sends an action to the server.
@@ -322,12 +453,7 @@ func (c *Client) SendAction(ctx context.Context, actionName string) (*Message, e
 		RequestToken: token,
 	}
 
-	err := c.mainConn.WriteJSON(action)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write action %s: %v", action.ActionName, err)
-	}
-
-	return c.ReadMessage(ctx, action.ActionName, token)
+	return c.request(ctx, actionName, token, action)
 }
 
 // GetSystemStatus returns basic system info from the resource.
@@ -335,13 +461,13 @@ func (c *Client) SendAction(ctx context.Context, actionName string) (*Message, e
 func (c *Client) GetSystemStatus(ctx context.Context) (*SystemStatusResponse, error) {
 	msg, err := c.SendAction(ctx, ActionSystemStatus)
 	if err != nil {
-		return nil, fmt.Errorf("send systemstatus: %v", err)
+		return nil, fmt.Errorf("send systemstatus: %w", err)
 	}
 
 	var resp SystemStatusResponse
 	err = json.Unmarshal(msg.Raw, &resp)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal systemstatus response: %v", err)
+		return nil, fmt.Errorf("unmarshal systemstatus response: %w", err)
 	}
 
 	return &resp, nil
@@ -349,95 +475,382 @@ func (c *Client) GetSystemStatus(ctx context.Context) (*SystemStatusResponse, er
 
 // SendEvent sends an event containing value to the cell.
 //
+// If the cell is read-only, it returns an error matching [ErrReadOnly] without
+// sending anything. Permissions of cells are known after the first call to
+// [Client.GetSystemConfig] or [Client.RecordPermissions].
+//
 // Events are named "Xevents" in F&Home's terminology.
 func (c *Client) SendEvent(ctx context.Context, cellID int, value string) error {
-	actionName := ActionEvent
-	token := generateRequestToken()
+	if c.isReadOnly(cellID) {
+		return fmt.Errorf("send event to cell %d: %w", cellID, ErrReadOnly)
+	}
 
-	event := Event{
-		ActionName:   actionName,
+	event := c.newEvent(cellID, value)
+
+	_, err := c.request(ctx, event.ActionName, event.RequestToken, event)
+	return err
+}
+
+// newEvent returns an "xevent" containing value for the cell, with a new
+// request token.
+func (c *Client) newEvent(cellID int, value string) Event {
+	return Event{
+		ActionName:   ActionEvent,
 		Login:        *c.email,
 		PasswordHash: *c.resourcePasswordHash,
-		RequestToken: token,
+		RequestToken: generateRequestToken(),
 		CellID:       strconv.Itoa(cellID),
 		Value:        value,
 		Type:         "HEX",
 	}
-	err := c.mainConn.WriteJSON(event)
+}
+
+// EventSpec is an event to send with [Client.SendEvents].
+type EventSpec struct {
+	CellID int
+	Value  string
+}
+
+// EventResult is the outcome of sending one [EventSpec].
+type EventResult struct {
+	EventSpec
+
+	// Err is nil if the resource accepted the event.
+	Err error
+}
+
+// SendEvents sends many events at once, like [Client.SendEvent] does for one.
+//
+// All events are written to the connection before waiting for any response,
+// so sending them takes about one round trip instead of one per event. The
+// resource applies them in order.
+//
+// It returns the results in the same order as events. An event failing doesn't
+// stop the others from being sent.
+func (c *Client) SendEvents(ctx context.Context, events []EventSpec) []EventResult {
+	results := make([]EventResult, len(events))
+	responses := make([]<-chan Message, len(events))
+
+	for i, spec := range events {
+		results[i].EventSpec = spec
+
+		if c.isReadOnly(spec.CellID) {
+			results[i].Err = fmt.Errorf("send event to cell %d: %w", spec.CellID, ErrReadOnly)
+			continue
+		}
+
+		event := c.newEvent(spec.CellID, spec.Value)
+		responses[i] = c.register(event.RequestToken)
+		defer c.unregister(event.RequestToken)
+
+		err := c.write(ctx, event)
+		if err != nil {
+			results[i].Err = fmt.Errorf("failed to write %s: %w", event.ActionName, err)
+			responses[i] = nil
+		}
+	}
+
+	for i, response := range responses {
+		if response == nil {
+			continue
+		}
+
+		_, results[i].Err = c.wait(ctx, response)
+	}
+
+	return results
+}
+
+// SetAndConfirm sends an event containing value to the cell, like
+// [Client.SendEvent], and waits until the cell reports the new value in
+// "statustoucheschanged". It returns the reported value.
+//
+// For [ValueToggle], any reported value confirms the event. For other values,
+// only the same value does, so a change caused by something else, e.g. a wall
+// switch, is not mistaken for the confirmation.
+//
+// If the cell doesn't report the new value before ctx is done, it returns an
+// error matching [ErrNotConfirmed]. It's unknown whether the resource reports
+// anything for a cell that already holds value, so callers that know the
+// current value should skip setting it instead of waiting for that.
+func (c *Client) SetAndConfirm(ctx context.Context, cellID int, value string) (*CellValue, error) {
+	// Subscribe before sending, so the change can't be missed.
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := c.Subscribe(subCtx, CellFilter{CellIDs: []int{cellID}})
+
+	err := c.SendEvent(ctx, cellID, value)
 	if err != nil {
-		return fmt.Errorf("failed to write %s to conn: %v", actionName, err)
+		return nil, err
 	}
 
-	_, err = c.ReadMessage(ctx, actionName, token)
-	return err
+	var last *CellValue
+	for {
+		select {
+		case <-ctx.Done():
+			if last != nil {
+				return nil, fmt.Errorf("cell %d reported %s instead of %s: %w: %w", cellID, last.Value, value, ErrNotConfirmed, contextError(ctx))
+			}
+			return nil, fmt.Errorf("cell %d reported nothing: %w: %w", cellID, ErrNotConfirmed, contextError(ctx))
+		case change, ok := <-changes:
+			if !ok {
+				if err := c.Err(); err != nil {
+					return nil, err
+				}
+				// ctx is done.
+				changes = nil
+				continue
+			}
+
+			for _, cv := range change.Values {
+				if value == ValueToggle || strings.EqualFold(cv.Value, value) {
+					return &cv, nil
+				}
+				last = &cv
+			}
+		}
+	}
 }
 
+// Close closes the client and its connections.
+//
+// Pending and future requests fail with [ErrClosed].
 func (c *Client) Close() error {
+	return c.terminate(ErrClosed)
+}
+
+// Done returns a channel that is closed when the session ends, either because
+// the client was closed or because of an unrecoverable error.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason why the session ended, or nil if it hasn't ended yet.
+//
+// If the client was closed with [Client.Close], it returns [ErrClosed].
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// terminate ends the session with reason, fails all pending requests and
+// closes the connections.
+func (c *Client) terminate(reason error) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.err = reason
+	close(c.done)
+	c.mu.Unlock()
+
+	c.failPending()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.connected = false
+
 	if err := c.setupConn.Close(); err != nil {
-		return fmt.Errorf("failed to close connection 1: %v", err)
+		return fmt.Errorf("failed to close connection 1: %w", err)
+	}
+
+	if c.mainConn == nil {
+		return nil
 	}
 
 	if err := c.mainConn.Close(); err != nil {
-		return fmt.Errorf("failed to close connection 2: %v", err)
+		return fmt.Errorf("failed to close connection 2: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Client) read() <-chan Message {
-	msgStream := make(chan Message, 1)
-	c.msgStreams[id()] = msgStream
-	return msgStream
+func connect(ctx context.Context, dialer *websocket.Dialer, url string) (*websocket.Conn, error) {
+	conn, resp, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if err := connError(ctx, err); errors.Is(err, ErrTimeout) || ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to dial: %w", err)
+		}
+
+		if resp != nil {
+			log.Println("failed to dial")
+			log.Printf("status: %s, headers: %d\n", resp.Status, len(resp.Header))
+			for name, value := range resp.Header {
+				log.Printf("header %s: %s\n", name, value)
+			}
+		}
+
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+
+	return conn, nil
 }
 
-// reader infinitely reads messages from c.conn2 and sends them to all
-// subscribers.
-func (c *Client) reader() {
+// dialSetup dials a new connection and consumes its first message.
+func (c *Client) dialSetup(ctx context.Context) (*websocket.Conn, error) {
+	conn, err := connect(ctx, c.dialer, c.url)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	release := bindConn(ctx, conn)
+	defer release()
+
+	var response Response
+	err = conn.ReadJSON(&response)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read json response: %w", connError(ctx, err))
+	}
+
+	if response.ActionName != "authentication_required" || response.Status != "" {
+		conn.Close()
+		return nil, fmt.Errorf("wrong first message received")
+	}
+
+	return conn, nil
+}
+
+// aLongTimeAgo is a deadline in the past, used to interrupt blocked reads and
+// writes.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// bindConn applies the deadline of ctx to reads and writes on conn, and
+// interrupts them when ctx is done. Call release when done with conn.
+//
+// A read or write that was interrupted breaks conn for good.
+func bindConn(ctx context.Context, conn *websocket.Conn) (release func()) {
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetReadDeadline(deadline)
+	_ = conn.SetWriteDeadline(deadline)
+
+	// The deadlines of the underlying connection can be set while another
+	// goroutine is blocked on it, unlike the write deadline of conn.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.NetConn().SetDeadline(aLongTimeAgo)
+	})
+
+	return func() {
+		if stop() {
+			_ = conn.SetReadDeadline(time.Time{})
+			_ = conn.SetWriteDeadline(time.Time{})
+		}
+	}
+}
+
+// handshake writes v to conn and reads messages from conn until it receives
+// the response with matching actionName and requestToken. The response is
+// unmarshaled into response, if it's not nil.
+//
+// It must not be used on a connection that is read by [Client.reader].
+func handshake(ctx context.Context, conn *websocket.Conn, actionName, requestToken string, v, response any) error {
+	release := bindConn(ctx, conn)
+	defer release()
+
+	err := conn.WriteJSON(v)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", actionName, connError(ctx, err))
+	}
+
 	for {
-		// read a new message in JSON
-		_, data, err := c.mainConn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
-			log.Fatalln("failed to read json from conn2:", err)
+			return fmt.Errorf("failed to read response: %w", connError(ctx, err))
 		}
 
-		// unmarshal it
-
-		var msg Message
-		err = json.Unmarshal(data, &msg)
+		var r Response
+		err = json.Unmarshal(data, &r)
 		if err != nil {
-			log.Fatalln("failed to unmarshal message:", err)
+			return fmt.Errorf("failed to unmarshal response: %w", err)
 		}
-		msg.Raw = data
 
-		// deliver it to all subscribers
-		for id, msgStream := range c.msgStreams {
-			msgStream <- msg
-			close(msgStream)
-			delete(c.msgStreams, id)
+		if r.ActionName != actionName {
+			continue
 		}
-	}
-}
 
-func connect(dialer *websocket.Dialer) (*websocket.Conn, error) {
-	conn, resp, err := dialer.Dial(URL, nil)
-	if err != nil {
-		if resp != nil {
-			log.Println("failed to dial")
-			log.Printf("status: %s, headers: %d\n", resp.Status, len(resp.Header))
-			for name, value := range resp.Header {
-				log.Printf("header %s: %s\n", name, value)
+		// Errors may come without the request token.
+		if r.Status != "ok" && (r.RequestToken == "" || r.RequestToken == requestToken) {
+			return &StatusError{Action: actionName, Status: r.Status, Details: r.Details, Raw: data}
+		}
+
+		if r.RequestToken != requestToken {
+			continue
+		}
+
+		if response != nil {
+			err = json.Unmarshal(data, response)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal %s response: %w", actionName, err)
 			}
 		}
 
-		return nil, fmt.Errorf("failed to dial: %v", err)
+		return nil
 	}
+}
 
-	return conn, nil
+func openClientSession(ctx context.Context, conn *websocket.Conn, email, password string) error {
+	actionName := ActionOpenClientSession
+	token := generateRequestToken()
+
+	return handshake(ctx, conn, actionName, token, OpenClientSession{
+		ActionName:   actionName,
+		Email:        email,
+		Password:     password,
+		RequestToken: token,
+	}, nil)
+}
+
+func getMyResources(ctx context.Context, conn *websocket.Conn, email string) (*GetMyResourcesResponse, error) {
+	actionName := ActionGetMyResources
+	token := generateRequestToken()
+
+	var response GetMyResourcesResponse
+	err := handshake(ctx, conn, actionName, token, GetMyResources{
+		ActionName:   actionName,
+		Email:        email,
+		RequestToken: token,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// UnassignedPanelID is the ID of the synthetic panel with cells that are not
+// placed in any panel, see [IncludeUnassigned].
+const UnassignedPanelID = "unassigned"
+
+// MergeOption configures [MergeConfigs].
+type MergeOption func(*mergeOptions)
+
+type mergeOptions struct {
+	includeUnassigned bool
+}
+
+// IncludeUnassigned makes [MergeConfigs] keep cells that are not placed in any
+// panel. They are grouped in a synthetic panel named "Unassigned" with ID
+// [UnassignedPanelID], and named after their description set in the
+// configurator app.
+func IncludeUnassigned() MergeOption {
+	return func(o *mergeOptions) {
+		o.includeUnassigned = true
+	}
 }
 
 // MergeConfigs creates [Config] config from the "get_user_config" and
 // "get_system_config" actions.
-func MergeConfigs(userConfig *UserConfig, touchesResp *TouchesResponse) (*Config, error) {
+func MergeConfigs(userConfig *UserConfig, touchesResp *TouchesResponse, opts ...MergeOption) (*Config, error) {
+	var options mergeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	panels := make([]Panel, 0)
 
 	for _, fPanel := range userConfig.Panels {
@@ -463,26 +876,45 @@ func MergeConfigs(userConfig *UserConfig, touchesResp *TouchesResponse) (*Config
 
 	cfg := Config{Panels: panels}
 
+	unassigned := make([]Cell, 0)
 	for _, mdcell := range touchesResp.Response.MobileDisplayProperties.Cells {
 		cellID, err := strconv.Atoi(mdcell.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert cell ID %s to int: %v", mdcell.ID, err)
+			return nil, fmt.Errorf("failed to convert cell ID %s to int: %w", mdcell.ID, err)
 		}
 
 		cell, err := cfg.GetCellByID(cellID)
 		if err != nil {
-			// cellID doesn't belong to any panels, ignore this case
-			continue
+			// cellID doesn't belong to any panels
+			if !options.includeUnassigned {
+				continue
+			}
+
+			unassigned = append(unassigned, Cell{
+				ID:   cellID,
+				Icon: CreateIcon("icon_cell_" + mdcell.TypeNumber + "_white"),
+				Name: mdcell.Desc,
+			})
+			cell = &unassigned[len(unassigned)-1]
 		}
 
 		cell.Desc = mdcell.Desc
-		cell.Value = mdcell.Step // FIXME: this is wrong; for thermo-setters this is 0.5, for thermo-getters this is actual value
 		cell.TypeNumber = mdcell.TypeNumber
 		cell.DisplayType = string(mdcell.DisplayType)
 		cell.Preset = mdcell.Preset
 		cell.Style = mdcell.Style
 		cell.MinValue = mdcell.MinValue
 		cell.MaxValue = mdcell.MaxValue
+		cell.Step = mdcell.Step
+		cell.Permission = Permission(mdcell.Permission)
+	}
+
+	if len(unassigned) > 0 {
+		cfg.Panels = append(cfg.Panels, Panel{
+			ID:    UnassignedPanelID,
+			Name:  "Unassigned",
+			Cells: unassigned,
+		})
 	}
 
 	return &cfg, nil
@@ -509,8 +941,3 @@ func generatePasswordHash(password string) *string {
 	stringHash := base64.StdEncoding.EncodeToString(hash)
 	return &stringHash
 }
-
-// id generates a random int
-func id() int {
-	return rand.Intn(100000)
-}
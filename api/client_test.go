@@ -0,0 +1,370 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+)
+
+var testHouse = fhometest.House{
+	Panels: []fhometest.Panel{
+		{
+			ID:   "1",
+			Name: "Ground floor",
+			Cells: []fhometest.Cell{
+				{ID: 300, Name: "Kitchen", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 301, Name: "Hall", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 302, Name: "Living room", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 400, Name: "Thermostat", Icon: api.IconTemperature, DisplayType: api.Temperature, Step: "0xa005", Value: "0xa0fa"},
+			},
+		},
+	},
+}
+
+func TestClient_GetConfigs(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userConfig, err := client.GetUserConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetUserConfig() error = %v", err)
+	}
+
+	sysConfig, err := client.GetSystemConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetSystemConfig() error = %v", err)
+	}
+
+	cfg, err := api.MergeConfigs(userConfig, sysConfig)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	if got := len(cfg.Cells()); got != 4 {
+		t.Errorf("got %d cells, want 4", got)
+	}
+
+	cell, err := cfg.GetCellByID(400)
+	if err != nil {
+		t.Fatalf("GetCellByID() error = %v", err)
+	}
+	if cell.Name != "Thermostat" || cell.DisplayType != string(api.Temperature) {
+		t.Errorf("got cell %+v, want Thermostat with display type TEMP", cell)
+	}
+}
+
+func TestMergeConfigs_IncludeUnassigned(t *testing.T) {
+	house := testHouse
+	house.Unassigned = []fhometest.Cell{
+		{ID: 600, Desc: "Boiler room light", TypeNumber: "710", DisplayType: api.Percentage, Value: "0x6000"},
+	}
+	srv := fhometest.NewServer(t, house)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userConfig, err := client.GetUserConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetUserConfig() error = %v", err)
+	}
+
+	sysConfig, err := client.GetSystemConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetSystemConfig() error = %v", err)
+	}
+
+	cfg, err := api.MergeConfigs(userConfig, sysConfig)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+	if _, err := cfg.GetCellByID(600); err == nil {
+		t.Error("MergeConfigs() without IncludeUnassigned() kept unassigned cell 600")
+	}
+
+	cfg, err = api.MergeConfigs(userConfig, sysConfig, api.IncludeUnassigned())
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	panel, err := cfg.GetPanelByID(api.UnassignedPanelID)
+	if err != nil {
+		t.Fatalf("GetPanelByID() error = %v", err)
+	}
+	if len(panel.Cells) != 1 {
+		t.Fatalf("got %d unassigned cells, want 1", len(panel.Cells))
+	}
+
+	cell := panel.Cells[0]
+	if cell.ID != 600 || cell.Name != "Boiler room light" || cell.Icon != api.IconLighting {
+		t.Errorf("got cell %+v, want cell 600 named after its description with lighting icon", cell)
+	}
+	if got := len(cfg.Cells()); got != 5 {
+		t.Errorf("got %d cells, want 5", got)
+	}
+}
+
+func TestClient_ConcurrentRequests(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			err := client.SendEvent(ctx, 300+i%3, api.MapLighting(i))
+			if err != nil {
+				t.Errorf("SendEvent() error = %v", err)
+			}
+		})
+		wg.Go(func() {
+			_, err := client.GetUserConfig(ctx)
+			if err != nil {
+				t.Errorf("GetUserConfig() error = %v", err)
+			}
+		})
+		wg.Go(func() {
+			_, err := client.SendAction(ctx, api.ActionStatusTouches)
+			if err != nil {
+				t.Errorf("SendAction() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := len(srv.Events()); got != 10 {
+		t.Errorf("server received %d events, want 10", got)
+	}
+}
+
+func TestClient_SendEvents(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := []api.EventSpec{
+		{CellID: 300, Value: "0x6064"},
+		{CellID: 999, Value: "0x6064"},
+		{CellID: 301, Value: "0x6032"},
+		{CellID: 302, Value: api.ValueToggle},
+	}
+	results := client.SendEvents(ctx, events)
+
+	if len(results) != len(events) {
+		t.Fatalf("got %d results, want %d", len(results), len(events))
+	}
+	for i, result := range results {
+		if result.EventSpec != events[i] {
+			t.Errorf("result %d is for %+v, want %+v", i, result.EventSpec, events[i])
+		}
+
+		var statusErr *api.StatusError
+		if result.CellID == 999 {
+			if !errors.As(result.Err, &statusErr) {
+				t.Errorf("result for cell 999 error = %v, want StatusError", result.Err)
+			}
+		} else if result.Err != nil {
+			t.Errorf("result for cell %d error = %v", result.CellID, result.Err)
+		}
+	}
+
+	var got []int
+	for _, event := range srv.Events() {
+		got = append(got, event.CellID)
+	}
+	if want := []int{300, 301, 302}; !slices.Equal(got, want) {
+		t.Errorf("server received events for cells %v, want %v", got, want)
+	}
+}
+
+func TestClient_ReadMessage(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Pushes received before ReadMessage is called must not be lost.
+	srv.SetValue(300, "0x6032")
+	srv.SetValue(301, "0x6064")
+
+	for _, want := range []string{"300", "301"} {
+		msg, err := client.ReadMessage(ctx, api.ActionStatusTouchesChanged, "")
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+
+		if msg.ActionName != api.ActionStatusTouchesChanged {
+			t.Errorf("got %s, want %s", msg.ActionName, api.ActionStatusTouchesChanged)
+		}
+		if !strings.Contains(string(msg.Raw), `"VOI":"`+want+`"`) {
+			t.Errorf("got %s, want change of cell %s", msg.Raw, want)
+		}
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	states := make(chan api.ConnState, 10)
+	client := srv.Connect(t,
+		api.WithReconnect(&api.ReconnectPolicy{MinDelay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}),
+		api.WithStateHandler(func(state api.ConnState, err error) { states <- state }),
+	)
+
+	srv.DropConnections()
+
+	for _, want := range []api.ConnState{api.StateDisconnected, api.StateConnected} {
+		select {
+		case got := <-states:
+			if got != want {
+				t.Fatalf("got state %v, want %v", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for state %v", want)
+		}
+	}
+
+	err := client.SendEvent(ctx, 300, api.ValueToggle)
+	if err != nil {
+		t.Fatalf("SendEvent() after reconnect error = %v", err)
+	}
+
+	// Pushes are delivered on the new connection.
+	_, err = client.ReadMessage(ctx, api.ActionStatusTouchesChanged, "")
+	if err != nil {
+		t.Fatalf("ReadMessage() after reconnect error = %v", err)
+	}
+}
+
+func TestClient_Done(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := srv.Connect(t, api.WithReconnect(nil))
+
+	if err := client.Err(); err != nil {
+		t.Fatalf("Err() = %v before the session ended", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.ReadMessage(ctx, api.ActionStatusTouchesChanged, "")
+		errs <- err
+	}()
+
+	srv.DropConnections()
+
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for the session to end")
+	}
+
+	if client.Err() == nil {
+		t.Error("Err() = nil after the session ended")
+	}
+	if err := <-errs; err == nil {
+		t.Error("pending ReadMessage() succeeded after the session ended")
+	}
+
+	if err := client.SendEvent(ctx, 300, api.ValueToggle); err == nil {
+		t.Error("SendEvent() succeeded after the session ended")
+	}
+}
+
+func TestClient_SelectResource(t *testing.T) {
+	garage := fhometest.House{
+		UniqueID:     "garage-id",
+		FriendlyName: "Garage",
+		Panels: []fhometest.Panel{
+			{ID: "1", Name: "Garage", Cells: []fhometest.Cell{
+				{ID: 260, Name: "Gate", Icon: api.IconGate, DisplayType: api.Bit},
+			}},
+		},
+	}
+	srv := fhometest.NewServer(t, testHouse, garage)
+	client := srv.Dial(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.OpenCloudSession(ctx, fhometest.Email, fhometest.Password); err != nil {
+		t.Fatalf("OpenCloudSession() error = %v", err)
+	}
+
+	resources, err := client.GetMyResources(ctx)
+	if err != nil {
+		t.Fatalf("GetMyResources() error = %v", err)
+	}
+	if len(resources.Resources) != 2 {
+		t.Fatalf("got %d resources, want 2", len(resources.Resources))
+	}
+	if got := resources.Resources[1]; got.UniqueID != "garage-id" || got.FriendlyName != "Garage" {
+		t.Errorf("got resource %+v, want garage", got)
+	}
+
+	if _, err := client.SelectResource("nonexistent"); err == nil {
+		t.Error("SelectResource() of nonexistent resource succeeded")
+	}
+
+	resource, err := client.SelectResource("garage")
+	if err != nil {
+		t.Fatalf("SelectResource() error = %v", err)
+	}
+	if resource.UniqueID != "garage-id" {
+		t.Errorf("selected %+v, want garage", resource)
+	}
+
+	if err := client.OpenResourceSession(ctx, fhometest.ResourcePassword); err != nil {
+		t.Fatalf("OpenResourceSession() error = %v", err)
+	}
+
+	if err := client.SendEvent(ctx, 260, api.ValueToggle); err != nil {
+		t.Fatalf("SendEvent() error = %v", err)
+	}
+
+	events := srv.Events()
+	if len(events) != 1 || events[0].UniqueID != "garage-id" {
+		t.Errorf("got events %+v, want one event sent to the garage", events)
+	}
+}
+
+func TestClient_GetMyData(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := client.GetMyData(ctx)
+	if err != nil {
+		t.Fatalf("GetMyData() error = %v", err)
+	}
+
+	if data.Status != "ok" {
+		t.Errorf("got status %q, want %q", data.Status, "ok")
+	}
+	if data.Fields["email"] != fhometest.Email {
+		t.Errorf("got fields %v, want all fields of the response", data.Fields)
+	}
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Celsius is a temperature in degrees Celsius. It's the typed value of
+// [Temperature] cells.
+type Celsius float64
+
+// RangedCelsius is a temperature to encode with [Encode] within Range, usually
+// the range of the cell, see [Cell.TemperatureRange]. No range is assumed for a
+// plain [Celsius].
+type RangedCelsius struct {
+	Celsius Celsius
+	Range   TemperatureRange
+}
+
+// Percent is a percentage from 0 to 100. It's the typed value of [Percentage]
+// cells.
+type Percent int
+
+// Color is a color in the RGB color space. It's the typed value of [RGB] cells.
+type Color struct {
+	R, G, B uint8
+}
+
+func (c Color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ErrUnknownDisplayType is returned when there's no [Codec] for a display type.
+var ErrUnknownDisplayType = errors.New("unknown display type")
+
+// Codec converts values of cells of a single [DisplayType] between their
+// encoded and typed representation.
+type Codec interface {
+	// Decode returns the typed value of cv.
+	Decode(cv CellValue) (any, error)
+	// Encode returns v encoded as a value ready to be passed to
+	// [Client.SendEvent].
+	Encode(v any) (string, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[DisplayType]Codec{
+		Bit:         bitCodec{},
+		Byte:        byteCodec{},
+		Temperature: temperatureCodec{},
+		Percentage:  percentageCodec{},
+		RGB:         rgbCodec{},
+	}
+)
+
+// RegisterCodec makes codec handle values of cells of display type dt,
+// replacing the previous codec, if any.
+func RegisterCodec(dt DisplayType, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[dt] = codec
+}
+
+// CodecFor returns the codec for display type dt.
+func CodecFor(dt DisplayType) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecs[dt]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDisplayType, dt)
+	}
+
+	return codec, nil
+}
+
+// Decode returns the typed value of cv, according to its display type:
+//
+//   - [Bit]: bool
+//   - [Byte]: uint8
+//   - [Temperature]: [Celsius]
+//   - [Percentage]: [Percent]
+//   - [RGB]: [Color]
+func Decode(cv CellValue) (any, error) {
+	codec, err := CodecFor(cv.DisplayType)
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.Decode(cv)
+}
+
+// Encode returns v encoded as a value of a cell of display type dt, ready to be
+// passed to [Client.SendEvent]. See [Decode] for the accepted types. [Temperature]
+// also accepts [RangedCelsius].
+//
+// How values out of range are handled depends on the display type:
+//
+//   - [Byte]: values over 255 are an error
+//   - [Temperature]: a [RangedCelsius] is clamped and rounded to its range,
+//     other temperatures to [DefaultTemperatureRange]
+//   - [Percentage]: values are clamped to 0-100
+//
+// Only the encodings of [Temperature] and [Percentage] are confirmed with
+// captured traffic. Those of [Bit], [Byte] and [RGB] are inferred from the
+// values that such cells report, so the devices might not accept them.
+func Encode(dt DisplayType, v any) (string, error) {
+	codec, err := CodecFor(dt)
+	if err != nil {
+		return "", err
+	}
+
+	return codec.Encode(v)
+}
+
+// Values are 16-bit words, except for RGB.
+func formatWord(v int) string {
+	return fmt.Sprintf("0x%04x", v)
+}
+
+func parseHex(value string) (int, error) {
+	v := strings.TrimPrefix(value, "0x")
+	parsed, err := strconv.ParseInt(v, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse int from %s: %w", value, err)
+	}
+
+	return int(parsed), nil
+}
+
+// bitCodec handles on/off values: "0x0000" is off, anything else is on. Encoding
+// on as "0x0001" is not confirmed.
+type bitCodec struct{}
+
+func (bitCodec) Decode(cv CellValue) (any, error) {
+	v, err := parseHex(cv.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return v != 0, nil
+}
+
+func (bitCodec) Encode(v any) (string, error) {
+	on, ok := v.(bool)
+	if !ok {
+		return "", fmt.Errorf("cannot encode %T as %s, want bool", v, Bit)
+	}
+
+	if on {
+		return formatWord(1), nil
+	}
+
+	return formatWord(0), nil
+}
+
+// byteCodec handles values from 0 to 255, encoded as "0x00nn". The encoding is
+// not confirmed.
+type byteCodec struct{}
+
+func (byteCodec) Decode(cv CellValue) (any, error) {
+	v, err := parseHex(cv.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if v < 0 || v > 0xff {
+		return nil, fmt.Errorf("value %s is out of range for %s", cv.Value, Byte)
+	}
+
+	return uint8(v), nil
+}
+
+func (byteCodec) Encode(v any) (string, error) {
+	switch v := v.(type) {
+	case uint8:
+		return formatWord(int(v)), nil
+	case int:
+		if v < 0 || v > 0xff {
+			return "", fmt.Errorf("value %d is out of range for %s", v, Byte)
+		}
+		return formatWord(v), nil
+	default:
+		return "", fmt.Errorf("cannot encode %T as %s, want uint8", v, Byte)
+	}
+}
+
+// temperatureCodec handles temperatures, see [TemperatureRange.Encode].
+type temperatureCodec struct{}
+
+func (temperatureCodec) Decode(cv CellValue) (any, error) {
+	// The value string is what the apps display, so prefer it.
+	if v, err := DecodeTemperatureValueStr(cv.ValueStr); err == nil {
+		return Celsius(v), nil
+	}
+
+	v, err := DecodeTemperatureValue(cv.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return Celsius(v), nil
+}
+
+func (temperatureCodec) Encode(v any) (string, error) {
+	switch v := v.(type) {
+	case RangedCelsius:
+		return v.Range.Encode(float64(v.Celsius)), nil
+	case Celsius:
+		return DefaultTemperatureRange.Encode(float64(v)), nil
+	case float64:
+		return DefaultTemperatureRange.Encode(v), nil
+	case int:
+		return DefaultTemperatureRange.Encode(float64(v)), nil
+	default:
+		return "", fmt.Errorf("cannot encode %T as %s, want Celsius", v, Temperature)
+	}
+}
+
+// percentageCodec handles percentages, see [MapLighting].
+type percentageCodec struct{}
+
+func (percentageCodec) Decode(cv CellValue) (any, error) {
+	v, err := RemapLighting(cv.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if v < 0 || v > 100 {
+		return nil, fmt.Errorf("value %s is out of range for %s", cv.Value, Percentage)
+	}
+
+	return Percent(v), nil
+}
+
+func (percentageCodec) Encode(v any) (string, error) {
+	switch v := v.(type) {
+	case Percent:
+		return MapLighting(int(v)), nil
+	case int:
+		return MapLighting(v), nil
+	default:
+		return "", fmt.Errorf("cannot encode %T as %s, want Percent", v, Percentage)
+	}
+}
+
+// rgbCodec handles colors encoded as 24-bit "0xrrggbb". The encoding is not
+// confirmed.
+type rgbCodec struct{}
+
+func (rgbCodec) Decode(cv CellValue) (any, error) {
+	v, err := parseHex(cv.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if v < 0 || v > 0xffffff {
+		return nil, fmt.Errorf("value %s is out of range for %s", cv.Value, RGB)
+	}
+
+	return Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
+
+func (rgbCodec) Encode(v any) (string, error) {
+	c, ok := v.(Color)
+	if !ok {
+		return "", fmt.Errorf("cannot encode %T as %s, want Color", v, RGB)
+	}
+
+	return fmt.Sprintf("0x%02x%02x%02x", c.R, c.G, c.B), nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		cv      CellValue
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "Bit off",
+			cv:   CellValue{DisplayType: Bit, Value: "0x0000"},
+			want: false,
+		},
+		{
+			name: "Bit on",
+			cv:   CellValue{DisplayType: Bit, Value: "0x0001"},
+			want: true,
+		},
+		{
+			name: "Byte",
+			cv:   CellValue{DisplayType: Byte, Value: "0x00ff"},
+			want: uint8(255),
+		},
+		{
+			name:    "Byte out of range",
+			cv:      CellValue{DisplayType: Byte, Value: "0x0100"},
+			wantErr: true,
+		},
+		{
+			name: "Temperature from value string",
+			cv:   CellValue{DisplayType: Temperature, Value: "0xa0fa", ValueStr: "25,0°C"},
+			want: Celsius(25),
+		},
+		{
+			name: "Temperature from value",
+			cv:   CellValue{DisplayType: Temperature, Value: "0xa0fa"},
+			want: Celsius(25),
+		},
+		{
+			name: "Percentage",
+			cv:   CellValue{DisplayType: Percentage, Value: "0x6032"},
+			want: Percent(50),
+		},
+		{
+			name:    "Percentage out of range",
+			cv:      CellValue{DisplayType: Percentage, Value: "0xa0fa"},
+			wantErr: true,
+		},
+		{
+			name: "RGB",
+			cv:   CellValue{DisplayType: RGB, Value: "0xff8000"},
+			want: Color{R: 0xff, G: 0x80, B: 0x00},
+		},
+		{
+			name:    "Invalid hex",
+			cv:      CellValue{DisplayType: Bit, Value: "0xzz"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.cv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		dt      DisplayType
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "Bit on",
+			dt:    Bit,
+			value: true,
+			want:  "0x0001",
+		},
+		{
+			name:  "Bit off",
+			dt:    Bit,
+			value: false,
+			want:  "0x0000",
+		},
+		{
+			name:  "Byte",
+			dt:    Byte,
+			value: uint8(10),
+			want:  "0x000a",
+		},
+		{
+			name:    "Byte out of range",
+			dt:      Byte,
+			value:   256,
+			wantErr: true,
+		},
+		{
+			name:  "Temperature",
+			dt:    Temperature,
+			value: Celsius(21.5),
+			want:  EncodeTemperature(21.5),
+		},
+		{
+			name:  "Temperature above default range",
+			dt:    Temperature,
+			value: Celsius(35),
+			want:  EncodeTemperature(28),
+		},
+		{
+			name:  "Temperature in range of cell",
+			dt:    Temperature,
+			value: RangedCelsius{Celsius: 35, Range: TemperatureRange{Min: 0, Max: 90, Step: 0.5}},
+			want:  "0xa15e",
+		},
+		{
+			name:  "Temperature clamped to range of cell",
+			dt:    Temperature,
+			value: RangedCelsius{Celsius: 95, Range: TemperatureRange{Min: 0, Max: 90, Step: 0.5}},
+			want:  "0xa384",
+		},
+		{
+			name:  "Temperature rounded to step of cell",
+			dt:    Temperature,
+			value: RangedCelsius{Celsius: 21.3, Range: TemperatureRange{Min: 0, Max: 90, Step: 0.5}},
+			want:  "0xa0d7",
+		},
+		{
+			name:  "Percentage",
+			dt:    Percentage,
+			value: Percent(50),
+			want:  "0x6032",
+		},
+		{
+			name:  "RGB",
+			dt:    RGB,
+			value: Color{R: 0xff, G: 0x80, B: 0x00},
+			want:  "0xff8000",
+		},
+		{
+			name:    "Wrong type",
+			dt:      RGB,
+			value:   true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.dt, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownDisplayType(t *testing.T) {
+	_, err := Decode(CellValue{DisplayType: "FOO", Value: "0x0000"})
+	if !errors.Is(err, ErrUnknownDisplayType) {
+		t.Errorf("Decode() error = %v, want %v", err, ErrUnknownDisplayType)
+	}
+
+	_, err = Encode("FOO", true)
+	if !errors.Is(err, ErrUnknownDisplayType) {
+		t.Errorf("Encode() error = %v, want %v", err, ErrUnknownDisplayType)
+	}
+}
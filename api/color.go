@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseColor parses a color in one of the formats:
+//
+//   - "#rrggbb", e.g. "#ff8000"
+//   - "h,s,v", with hue in degrees (0-360), and saturation and value in
+//     percent (0-100), e.g. "30,100,100"
+func ParseColor(s string) (Color, error) {
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) != 6 {
+			return Color{}, fmt.Errorf("invalid color %q: want #rrggbb", s)
+		}
+
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+		}
+
+		return Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return Color{}, fmt.Errorf("invalid color %q: want #rrggbb or h,s,v", s)
+	}
+
+	var hsv [3]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+		}
+		hsv[i] = v
+	}
+
+	h, sat, v := hsv[0], hsv[1], hsv[2]
+	if h < 0 || h > 360 || sat < 0 || sat > 100 || v < 0 || v > 100 {
+		return Color{}, fmt.Errorf("invalid color %q: hue must be 0-360, saturation and value 0-100", s)
+	}
+
+	return ColorFromHSV(h, sat, v), nil
+}
+
+// ColorFromHSV converts a color from the HSV color space, with hue in degrees
+// (0-360), and saturation and value in percent (0-100).
+func ColorFromHSV(h, s, v float64) Color {
+	s /= 100
+	v /= 100
+
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return Color{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+	}
+}
+
+// HSV converts c to the HSV color space. It returns hue in degrees (0-360), and
+// saturation and value in percent (0-100).
+func (c Color) HSV() (h, s, v float64) {
+	r := float64(c.R) / 255
+	g := float64(c.G) / 255
+	b := float64(c.B) / 255
+
+	maxC := max(r, g, b)
+	minC := min(r, g, b)
+	delta := maxC - minC
+
+	switch {
+	case delta == 0:
+		h = 0
+	case maxC == r:
+		h = 60 * math.Mod((g-b)/delta, 6)
+	case maxC == g:
+		h = 60 * ((b-r)/delta + 2)
+	default:
+		h = 60 * ((r-g)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+
+	if maxC > 0 {
+		s = delta / maxC * 100
+	}
+
+	return h, s, maxC * 100
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Color
+		wantErr bool
+	}{
+		{
+			name:  "Hex",
+			value: "#ff8000",
+			want:  Color{R: 0xff, G: 0x80, B: 0x00},
+		},
+		{
+			name:  "HSV red",
+			value: "0,100,100",
+			want:  Color{R: 0xff},
+		},
+		{
+			name:  "HSV blue at half value",
+			value: "240,100,50",
+			want:  Color{B: 0x80},
+		},
+		{
+			name:  "HSV white",
+			value: "123,0,100",
+			want:  Color{R: 0xff, G: 0xff, B: 0xff},
+		},
+		{
+			name:    "Short hex",
+			value:   "#fff",
+			wantErr: true,
+		},
+		{
+			name:    "Hue out of range",
+			value:   "400,100,100",
+			wantErr: true,
+		},
+		{
+			name:    "Garbage",
+			value:   "red",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseColor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseColor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorHSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		color   Color
+		h, s, v float64
+	}{
+		{
+			name:  "Black",
+			color: Color{},
+		},
+		{
+			name:  "Green",
+			color: Color{G: 0xff},
+			h:     120, s: 100, v: 100,
+		},
+		{
+			name:  "Magenta",
+			color: Color{R: 0xff, B: 0xff},
+			h:     300, s: 100, v: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, s, v := tt.color.HSV()
+			if math.Abs(h-tt.h) > 0.5 || math.Abs(s-tt.s) > 0.5 || math.Abs(v-tt.v) > 0.5 {
+				t.Errorf("HSV() = %v, %v, %v, want %v, %v, %v", h, s, v, tt.h, tt.s, tt.v)
+			}
+
+			if got := ColorFromHSV(h, s, v); got != tt.color {
+				t.Errorf("ColorFromHSV() = %v, want %v", got, tt.color)
+			}
+		})
+	}
+}
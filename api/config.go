@@ -75,11 +75,63 @@ type Cell struct {
 	Name string // Set in client apps
 	Desc string // Set in the configurator app
 
-	Value       string
+	// Live value of the cell, set by [Config.ApplyStatus]. Empty if unknown.
+	Value string
+	// Live value of the cell as displayed by the apps, set by
+	// [Config.ApplyStatus]. Empty if unknown.
+	ValueStr string
+
 	TypeNumber  string
 	DisplayType string
 	Preset      string
 	Style       string
 	MinValue    string
 	MaxValue    string
+	// Step by which the value can be changed. Not to be confused with the
+	// value itself.
+	Step       string
+	Permission Permission
+}
+
+// Permission says what the user can do with a cell.
+type Permission string
+
+const (
+	PermissionFullControl Permission = "FC"
+	PermissionReadOnly    Permission = "RO"
+)
+
+// ReadOnly reports whether the cell can only be read, e.g. because it's a
+// sensor.
+func (c *Cell) ReadOnly() bool {
+	return c.Permission == PermissionReadOnly
+}
+
+// TemperatureRange returns the range of temperatures accepted by a
+// [Temperature] cell, as set in the configurator app.
+func (c *Cell) TemperatureRange() (TemperatureRange, error) {
+	if c.DisplayType != string(Temperature) {
+		return TemperatureRange{}, fmt.Errorf("cell %d has display type %s, want %s", c.ID, c.DisplayType, Temperature)
+	}
+
+	minValue, err := DecodeTemperatureValue(c.MinValue)
+	if err != nil {
+		return TemperatureRange{}, fmt.Errorf("min value of cell %d: %w", c.ID, err)
+	}
+
+	maxValue, err := DecodeTemperatureValue(c.MaxValue)
+	if err != nil {
+		return TemperatureRange{}, fmt.Errorf("max value of cell %d: %w", c.ID, err)
+	}
+
+	step, err := DecodeTemperatureValue(c.Step)
+	if err != nil {
+		return TemperatureRange{}, fmt.Errorf("step of cell %d: %w", c.ID, err)
+	}
+
+	if minValue > maxValue || step < 0 {
+		return TemperatureRange{}, fmt.Errorf("cell %d has invalid range %s-%s with step %s", c.ID, c.MinValue, c.MaxValue, c.Step)
+	}
+
+	return TemperatureRange{Min: minValue, Max: maxValue, Step: step}, nil
 }
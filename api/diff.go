@@ -0,0 +1,118 @@
+package api
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// ConfigDiff describes how cells changed between two configs, e.g. after the
+// project was changed in the configurator app.
+//
+// Cells are identified by ID and sorted by it.
+type ConfigDiff struct {
+	Added   []Cell
+	Removed []Cell
+	Changed []CellDiff
+}
+
+// Empty reports whether the configs are equivalent.
+func (d *ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// CellDiff describes how a cell present in both configs changed.
+type CellDiff struct {
+	ID int
+	// Name of the cell in the newer config.
+	Name   string
+	Fields []FieldDiff
+}
+
+// FieldDiff is a change of a single property of a cell.
+type FieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Properties of cells compared by [DiffConfigs], other than panels.
+var diffedFields = []struct {
+	name  string
+	value func(c *Cell) string
+}{
+	{"Name", func(c *Cell) string { return c.Name }},
+	{"Desc", func(c *Cell) string { return c.Desc }},
+	{"TypeNumber", func(c *Cell) string { return c.TypeNumber }},
+	{"DisplayType", func(c *Cell) string { return c.DisplayType }},
+	{"MinValue", func(c *Cell) string { return c.MinValue }},
+	{"MaxValue", func(c *Cell) string { return c.MaxValue }},
+	{"Permission", func(c *Cell) string { return string(c.Permission) }},
+}
+
+// DiffConfigs returns the changes of cells from oldConfig to newConfig.
+//
+// Besides properties of cells, it compares the panels they're placed in. Live
+// values are ignored.
+func DiffConfigs(oldConfig, newConfig *Config) *ConfigDiff {
+	oldCells, oldPanels := indexCells(oldConfig)
+	newCells, newPanels := indexCells(newConfig)
+
+	diff := &ConfigDiff{}
+	for id, newCell := range newCells {
+		oldCell, ok := oldCells[id]
+		if !ok {
+			diff.Added = append(diff.Added, newCell)
+			continue
+		}
+
+		var fields []FieldDiff
+		for _, field := range diffedFields {
+			o, n := field.value(&oldCell), field.value(&newCell)
+			if o != n {
+				fields = append(fields, FieldDiff{Field: field.name, Old: o, New: n})
+			}
+		}
+
+		o, n := strings.Join(oldPanels[id], ", "), strings.Join(newPanels[id], ", ")
+		if o != n {
+			fields = append(fields, FieldDiff{Field: "Panels", Old: o, New: n})
+		}
+
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, CellDiff{ID: id, Name: newCell.Name, Fields: fields})
+		}
+	}
+
+	for id, oldCell := range oldCells {
+		if _, ok := newCells[id]; !ok {
+			diff.Removed = append(diff.Removed, oldCell)
+		}
+	}
+
+	byID := func(a, b Cell) int { return cmp.Compare(a.ID, b.ID) }
+	slices.SortFunc(diff.Added, byID)
+	slices.SortFunc(diff.Removed, byID)
+	slices.SortFunc(diff.Changed, func(a, b CellDiff) int { return cmp.Compare(a.ID, b.ID) })
+
+	return diff
+}
+
+// indexCells returns the cells of config by ID, and the sorted names of panels
+// that each cell is placed in.
+func indexCells(config *Config) (map[int]Cell, map[int][]string) {
+	cells := make(map[int]Cell)
+	panels := make(map[int][]string)
+	for _, panel := range config.Panels {
+		for _, cell := range panel.Cells {
+			cells[cell.ID] = cell
+			panels[cell.ID] = append(panels[cell.ID], panel.Name)
+		}
+	}
+
+	for _, names := range panels {
+		slices.Sort(names)
+	}
+
+	return cells, panels
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	oldConfig := &Config{
+		Panels: []Panel{
+			{ID: "1", Name: "Kitchen", Cells: []Cell{
+				{ID: 300, Name: "Light", DisplayType: "PROC", MinValue: "0x6000", MaxValue: "0x6064"},
+				{ID: 301, Name: "Fan", DisplayType: "BIT"},
+			}},
+			{ID: "2", Name: "Garden", Cells: []Cell{
+				{ID: 302, Name: "Gate", TypeNumber: "724"},
+			}},
+		},
+	}
+
+	newConfig := &Config{
+		Panels: []Panel{
+			{ID: "1", Name: "Kitchen", Cells: []Cell{
+				{ID: 300, Name: "Ceiling light", DisplayType: "PROC", MinValue: "0x6000", MaxValue: "0x6050", Value: "0x6032"},
+				{ID: 303, Name: "Heating", DisplayType: "TEMP"},
+			}},
+			{ID: "2", Name: "Garden", Cells: []Cell{
+				{ID: 302, Name: "Gate", TypeNumber: "724"},
+			}},
+			{ID: "3", Name: "Garage", Cells: []Cell{
+				{ID: 302, Name: "Gate", TypeNumber: "724"},
+			}},
+		},
+	}
+
+	got := DiffConfigs(oldConfig, newConfig)
+	want := &ConfigDiff{
+		Added:   []Cell{{ID: 303, Name: "Heating", DisplayType: "TEMP"}},
+		Removed: []Cell{{ID: 301, Name: "Fan", DisplayType: "BIT"}},
+		Changed: []CellDiff{
+			{ID: 300, Name: "Ceiling light", Fields: []FieldDiff{
+				{Field: "Name", Old: "Light", New: "Ceiling light"},
+				{Field: "MaxValue", Old: "0x6064", New: "0x6050"},
+			}},
+			{ID: 302, Name: "Gate", Fields: []FieldDiff{
+				{Field: "Panels", Old: "Garden", New: "Garage, Garden"},
+			}},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffConfigs() = %+v, want %+v", got, want)
+	}
+
+	if !DiffConfigs(newConfig, newConfig).Empty() {
+		t.Error("DiffConfigs() of equal configs is not empty")
+	}
+}
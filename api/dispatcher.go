@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// pushesBufferSize is the number of unsolicited messages buffered for
+// [Client.ReadMessage] and [Client.ReadAnyMessage].
+const pushesBufferSize = 64
+
+// request writes v to the main connection and waits for the response with
+// matching requestToken.
+//
+// It is safe to call request from many goroutines at once.
+func (c *Client) request(ctx context.Context, actionName, requestToken string, v any) (*Message, error) {
+	response := c.register(requestToken)
+	defer c.unregister(requestToken)
+
+	err := c.write(ctx, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", actionName, err)
+	}
+
+	return c.wait(ctx, response)
+}
+
+// writeTimeout bounds writes to the main connection made with a ctx that has
+// no deadline.
+const writeTimeout = 10 * time.Second
+
+// write writes v as JSON to the main connection, before the deadline of ctx.
+//
+// It fails with [ErrConnectionLost] if the connection is broken, or with
+// [Client.Err] if the session has ended.
+func (c *Client) write(ctx context.Context, v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if !c.connected {
+		if err := c.Err(); err != nil {
+			return err
+		}
+
+		return ErrConnectionLost
+	}
+
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(writeTimeout)
+	}
+	_ = c.mainConn.SetWriteDeadline(deadline)
+
+	err := c.mainConn.WriteJSON(v)
+	if err != nil {
+		// A failed write breaks the connection for good.
+		c.breakConn(fmt.Errorf("failed to write: %w", err))
+		return connError(ctx, err)
+	}
+
+	return nil
+}
+
+// breakConn closes the main connection because of err. The reader notices and
+// handles it according to the reconnect policy, reporting err as the reason.
+//
+// It must be called with writeMu held.
+func (c *Client) breakConn(err error) {
+	if c.broken == nil {
+		c.broken = err
+	}
+
+	c.mainConn.Close()
+}
+
+// wait returns the first message received from messages.
+//
+// If it has status and it is not "ok", it returns an error. If the session has
+// ended, it returns the reason. If messages is closed otherwise, it returns
+// [ErrConnectionLost].
+func (c *Client) wait(ctx context.Context, messages <-chan Message) (*Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for response: %w", contextError(ctx))
+	case <-c.done:
+		return nil, c.Err()
+	case msg, ok := <-messages:
+		if !ok {
+			if err := c.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, ErrConnectionLost
+		}
+
+		return checkStatus(&msg)
+	}
+}
+
+// checkStatus returns a [StatusError] if msg has status and it is not "ok".
+func checkStatus(msg *Message) (*Message, error) {
+	if msg.Status != nil && *msg.Status != "" && *msg.Status != "ok" {
+		var response Response
+		_ = json.Unmarshal(msg.Raw, &response)
+
+		return nil, &StatusError{
+			Action:  msg.ActionName,
+			Status:  *msg.Status,
+			Details: response.Details,
+			Raw:     msg.Raw,
+		}
+	}
+
+	return msg, nil
+}
+
+// register returns a channel that receives the response to the request with
+// requestToken.
+func (c *Client) register(requestToken string) <-chan Message {
+	response := make(chan Message, 1)
+
+	c.mu.Lock()
+	c.pending[requestToken] = response
+	c.mu.Unlock()
+
+	return response
+}
+
+func (c *Client) unregister(requestToken string) {
+	c.mu.Lock()
+	delete(c.pending, requestToken)
+	c.mu.Unlock()
+}
+
+// failPending makes all pending requests fail with [ErrConnectionLost] or, if
+// the session has ended, with [Client.Err].
+func (c *Client) failPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for token, response := range c.pending {
+		close(response)
+		delete(c.pending, token)
+	}
+}
+
+// subscribe returns a channel that receives all messages that are not a
+// response to a pending request.
+//
+// If the subscriber doesn't keep up and the buffer of size is full, the oldest
+// message is dropped. Call unsubscribe to stop receiving messages.
+func (c *Client) subscribe(size int) (messages chan Message, unsubscribe func()) {
+	messages = make(chan Message, size)
+
+	c.mu.Lock()
+	c.subscribers[messages] = struct{}{}
+	c.mu.Unlock()
+
+	unsubscribe = func() {
+		c.mu.Lock()
+		delete(c.subscribers, messages)
+		c.mu.Unlock()
+	}
+
+	return messages, unsubscribe
+}
+
+// dispatch delivers msg to the pending request it is a response to. If there is
+// no such request, msg is delivered to all subscribers.
+func (c *Client) dispatch(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if msg.RequestToken != nil {
+		if response, ok := c.pending[*msg.RequestToken]; ok {
+			response <- msg
+			delete(c.pending, *msg.RequestToken)
+			return
+		}
+	}
+
+	for messages := range c.subscribers {
+		select {
+		case messages <- msg:
+		default:
+			// Drop the oldest message to make room for the new one.
+			select {
+			case <-messages:
+			default:
+			}
+			select {
+			case messages <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// reader infinitely reads messages from the main connection and dispatches
+// them.
+//
+// When the connection breaks, it reconnects according to the reconnect policy.
+// If that's not possible, or the server sends "disconnecting", it ends the
+// session.
+func (c *Client) reader() {
+	conn := c.mainConn
+	for {
+		// read a new message in JSON
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if c.isClosed() {
+				return
+			}
+
+			c.writeMu.Lock()
+			c.connected = false
+			if c.broken != nil {
+				err = c.broken
+			}
+			c.writeMu.Unlock()
+			c.failPending()
+
+			if c.reconnect == nil {
+				c.end(fmt.Errorf("failed to read message: %w", err))
+				return
+			}
+
+			c.setState(StateDisconnected, err)
+			conn, err = c.redial()
+			if err != nil {
+				c.end(fmt.Errorf("failed to reconnect: %w", err))
+				return
+			}
+			c.setState(StateConnected, nil)
+
+			continue
+		}
+
+		c.lastMessageAt.Store(time.Now().UnixNano())
+
+		// unmarshal it
+
+		var msg Message
+		err = json.Unmarshal(data, &msg)
+		if err != nil {
+			c.end(fmt.Errorf("failed to unmarshal message: %w", err))
+			return
+		}
+		msg.Raw = data
+
+		if msg.ActionName == ActionDisconnecting {
+			var response Response
+			_ = json.Unmarshal(data, &response)
+			c.end(&DisconnectedError{Reason: response.Reason, Details: response.Details})
+			return
+		}
+
+		c.dispatch(msg)
+	}
+}
+
+// end ends the session because of err, unless it has already ended.
+func (c *Client) end(err error) {
+	if c.isClosed() {
+		return
+	}
+
+	_ = c.terminate(err)
+	c.setState(StateClosed, err)
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrAuthentication is returned when the server rejects the credentials.
+	ErrAuthentication = errors.New("authentication failed")
+
+	// ErrTimeout is returned when the deadline passes before the server
+	// responds.
+	ErrTimeout = errors.New("timeout")
+
+	// ErrConnectionLost is returned for requests that were pending or sent
+	// while the connection to the server was broken.
+	ErrConnectionLost = errors.New("connection lost")
+
+	// ErrClosed is returned for requests made after the client was closed.
+	ErrClosed = errors.New("client closed")
+
+	// ErrReadOnly is returned for events sent to cells that can't be
+	// controlled.
+	ErrReadOnly = errors.New("cell is read-only")
+
+	// ErrNotConfirmed is returned by [Client.SetAndConfirm] when the cell
+	// doesn't report the new value in time. The event was sent, but it's
+	// unknown whether it took effect.
+	ErrNotConfirmed = errors.New("state change not confirmed")
+
+	// ErrStale is the reason the main connection is considered broken when
+	// no messages arrive on it and it doesn't respond to a probe. See
+	// [KeepalivePolicy].
+	ErrStale = errors.New("connection stale")
+)
+
+// StatusError is returned when the server responds to an action with a status
+// other than "ok".
+//
+// A StatusError for one of the requests that open a session, that is
+// "open_client_session", "open_client_to_resource_session" and the
+// "statustouches" that checks the resource password in
+// [Client.OpenResourceSession], matches [ErrAuthentication] if its details
+// mention a login or password. The statuses and details the server sends for
+// rejected credentials aren't documented and haven't been captured, so this is
+// a guess. Other failures of these requests, e.g. an unknown resource, don't
+// match.
+type StatusError struct {
+	Action  string
+	Status  string
+	Details string
+	Raw     []byte // The whole response
+}
+
+func (e *StatusError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%s: status %q: %s", e.Action, e.Status, e.Details)
+	}
+
+	return fmt.Sprintf("%s: status %q", e.Action, e.Status)
+}
+
+func (e *StatusError) Is(target error) bool {
+	if target != ErrAuthentication {
+		return false
+	}
+
+	switch e.Action {
+	case ActionOpenClientSession, ActionOpenClienToResourceSession, ActionStatusTouches:
+	default:
+		return false
+	}
+
+	details := strings.ToLower(e.Details)
+	return strings.Contains(details, "password") || strings.Contains(details, "login")
+}
+
+// DisconnectedError is returned when the server ends the session by sending
+// the "disconnecting" action.
+type DisconnectedError struct {
+	Reason  string
+	Details string
+}
+
+func (e *DisconnectedError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("disconnected by server: %s: %s", e.Reason, e.Details)
+	}
+
+	return fmt.Sprintf("disconnected by server: %s", e.Reason)
+}
+
+// contextError returns the error of the done ctx, marked with [ErrTimeout] if
+// its deadline has passed. If ctx was canceled with a cause, the cause is
+// wrapped too.
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if cause := context.Cause(ctx); cause != nil && cause != err {
+		err = fmt.Errorf("%w: %w", err, cause)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	return err
+}
+
+// connError returns the error to report for err, returned when dialing or by a
+// read or write on a connection bound to ctx with bindConn.
+//
+// If ctx is done, that's the reason, even if the connection failed with a less
+// meaningful error.
+func connError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+
+	// The deadline of the connection may pass a moment before the one of ctx.
+	// gorilla/websocket hides the original error of a timed out read, so it
+	// can only be recognized as a net.Error.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	return err
+}
@@ -0,0 +1,242 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+)
+
+func TestErrAuthentication(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Dial(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := client.OpenCloudSession(ctx, fhometest.Email, "wrong")
+	if !errors.Is(err, api.ErrAuthentication) {
+		t.Errorf("OpenCloudSession() error = %v, want ErrAuthentication", err)
+	}
+}
+
+func TestErrAuthentication_TokenlessError(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	srv.SetTokenlessErrors(true)
+	client := srv.Dial(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := client.OpenCloudSession(ctx, fhometest.Email, "wrong")
+	if !errors.Is(err, api.ErrAuthentication) {
+		t.Errorf("OpenCloudSession() error = %v, want ErrAuthentication", err)
+	}
+}
+
+func TestErrAuthentication_ResourcePassword(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.ConnectCloud(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := client.OpenResourceSession(ctx, "wrong")
+	if !errors.Is(err, api.ErrAuthentication) {
+		t.Errorf("OpenResourceSession() error = %v, want ErrAuthentication", err)
+	}
+}
+
+func TestStatusError_ResourceSession(t *testing.T) {
+	tests := []struct {
+		action  string
+		details string
+	}{
+		{action: api.ActionOpenClienToResourceSession, details: "no such resource"},
+		{action: api.ActionStatusTouches, details: "resource not connected"},
+	}
+
+	for _, tt := range tests {
+		srv := fhometest.NewServer(t, testHouse)
+		srv.FailAction(tt.action, tt.details)
+		client := srv.ConnectCloud(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Only rejected credentials mean that authentication failed.
+		err := client.OpenResourceSession(ctx, fhometest.ResourcePassword)
+		var statusErr *api.StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("OpenResourceSession() with %s failing error = %v, want StatusError", tt.action, err)
+		}
+		if errors.Is(err, api.ErrAuthentication) {
+			t.Errorf("OpenResourceSession() with %s failing error = %v matches ErrAuthentication", tt.action, err)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := client.SendEvent(ctx, 999, api.ValueToggle)
+
+	var statusErr *api.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("SendEvent() error = %v, want StatusError", err)
+	}
+	if statusErr.Action != api.ActionEvent {
+		t.Errorf("got action %q, want %q", statusErr.Action, api.ActionEvent)
+	}
+	if errors.Is(err, api.ErrAuthentication) {
+		t.Errorf("SendEvent() error = %v matches ErrAuthentication", err)
+	}
+}
+
+func TestErrTimeout(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.ReadMessage(ctx, api.ActionStatusTouchesChanged, "")
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Errorf("ReadMessage() error = %v, want ErrTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadMessage() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestErrTimeout_Handshake(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Dial(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srv.SetSilent(true)
+
+	shortCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	err := client.OpenCloudSession(shortCtx, fhometest.Email, fhometest.Password)
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Errorf("OpenCloudSession() error = %v, want ErrTimeout", err)
+	}
+
+	// A silent server doesn't even ask for authentication.
+	_, err = api.NewClient(shortCtx, nil, api.WithURL(srv.URL))
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Errorf("NewClient() error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	srv.SetSilent(true)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cause := errors.New("user gave up")
+	time.AfterFunc(50*time.Millisecond, func() { cancel(cause) })
+
+	_, err := client.GetSystemStatus(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetSystemStatus() error = %v, want context.Canceled", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("GetSystemStatus() error = %v, want its cause", err)
+	}
+	if errors.Is(err, api.ErrTimeout) {
+		t.Errorf("GetSystemStatus() error = %v matches ErrTimeout", err)
+	}
+}
+
+func TestDisconnectedError(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	srv.Disconnect("session_expired", "logged in elsewhere")
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the session to end")
+	}
+
+	var disconnectedErr *api.DisconnectedError
+	if !errors.As(client.Err(), &disconnectedErr) {
+		t.Fatalf("Err() = %v, want DisconnectedError", client.Err())
+	}
+	if disconnectedErr.Reason != "session_expired" || disconnectedErr.Details != "logged in elsewhere" {
+		t.Errorf("got %+v, want reason and details sent by the server", disconnectedErr)
+	}
+}
+
+func TestErrReadOnly(t *testing.T) {
+	house := fhometest.House{
+		Panels: []fhometest.Panel{
+			{
+				ID:   "1",
+				Name: "Ground floor",
+				Cells: []fhometest.Cell{
+					{ID: 300, Name: "Kitchen", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+					{ID: 500, Name: "Outside", Icon: api.IconTemperature, DisplayType: api.Temperature, Permission: "RO", Value: "0xa0fa"},
+				},
+			},
+		},
+	}
+	srv := fhometest.NewServer(t, house)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sysConfig, err := client.GetSystemConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetSystemConfig() error = %v", err)
+	}
+
+	userConfig, err := client.GetUserConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetUserConfig() error = %v", err)
+	}
+
+	cfg, err := api.MergeConfigs(userConfig, sysConfig)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	cell, err := cfg.GetCellByID(500)
+	if err != nil {
+		t.Fatalf("GetCellByID() error = %v", err)
+	}
+	if !cell.ReadOnly() {
+		t.Errorf("cell 500 has permission %q, want read-only", cell.Permission)
+	}
+
+	err = client.SendEvent(ctx, 500, api.EncodeTemperature(20))
+	if !errors.Is(err, api.ErrReadOnly) {
+		t.Errorf("SendEvent() to read-only cell error = %v, want %v", err, api.ErrReadOnly)
+	}
+
+	err = client.SendEvent(ctx, 300, api.ValueToggle)
+	if err != nil {
+		t.Errorf("SendEvent() to full control cell error = %v", err)
+	}
+
+	events := srv.Events()
+	if len(events) != 1 || events[0].CellID != 300 {
+		t.Errorf("server received events %+v, want one event to cell 300", events)
+	}
+}
@@ -0,0 +1,806 @@
+// Package fhometest provides an in-process fake F&Home server for testing code
+// that uses the [api] package.
+//
+// The server speaks the same websocket protocol as F&Home Cloud, but its state
+// is defined declaratively with [House], [Panel] and [Cell]:
+//
+//	srv := fhometest.NewServer(t, fhometest.House{
+//		Panels: []fhometest.Panel{
+//			{ID: "1", Name: "Kitchen", Cells: []fhometest.Cell{
+//				{ID: 300, Name: "Ceiling", DisplayType: api.Percentage, Value: "0x6000"},
+//			}},
+//		},
+//	})
+//
+//	client, err := api.NewClient(ctx, nil, api.WithURL(srv.URL))
+//
+// [Server.Connect] does the whole handshake for tests that don't test it.
+package fhometest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Credentials accepted by the server.
+const (
+	Email            = "test@example.com"
+	Password         = "cloud-password"
+	ResourcePassword = "resource-password"
+)
+
+// House is a single resource (installation) served by the [Server].
+type House struct {
+	// Defaults to "fhometest-<index>" if empty.
+	UniqueID string
+	// Defaults to "House" if empty.
+	FriendlyName string
+	// Defaults to "resource" if empty.
+	ResourceType string
+	// Defaults to [ResourcePassword] if empty.
+	ResourcePassword string
+	// Defaults to "1" if empty.
+	ProjectVersion string
+
+	Panels []Panel
+	// Cells that are not placed in any panel. They are only in the system
+	// config.
+	Unassigned []Cell
+}
+
+// Panel is a group of cells, as set in the client apps.
+type Panel struct {
+	ID    string
+	Name  string
+	Cells []Cell
+}
+
+// Cell is a single object of a [House].
+//
+// A cell with the same ID may be placed in many panels. Properties of its first
+// occurrence are used.
+type Cell struct {
+	ID   int
+	Name string // Set in client apps
+	Icon api.Icon
+	Desc string // Set in the configurator app
+
+	TypeNumber  string
+	DisplayType api.DisplayType
+	Preset      string
+	Style       string
+	MinValue    string
+	MaxValue    string
+	Step        string
+	// Defaults to "FC" if empty.
+	Permission string
+
+	// Initial value of the cell.
+	Value string
+	// Initial value string of the cell. Derived from Value if empty.
+	ValueStr string
+
+	// If true, events sent to the cell are acknowledged, but its value never
+	// changes, as if the device were offline.
+	Unresponsive bool
+}
+
+// Event is an "xevent" received by the [Server].
+type Event struct {
+	UniqueID string // Unique ID of the house the event was sent to
+	CellID   int
+	Value    string
+	Type     string
+}
+
+// Server is a fake F&Home server.
+type Server struct {
+	// URL of the websocket endpoint, ready to be passed to [api.WithURL].
+	URL string
+
+	tb       testing.TB
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	houses   []*house
+	events   []Event
+	sessions map[*session]struct{}
+	// Whether the server ignores everything, see SetSilent.
+	silent bool
+	// Whether error responses have no request token, see SetTokenlessErrors.
+	tokenlessErrors bool
+	// Maps action name to the number of requests, see Requests.
+	requests map[string]int
+	// Maps action name to the details of its failure, see FailAction.
+	failures map[string]string
+}
+
+type house struct {
+	House
+	passwordHash string
+	cells        []*Cell // in order of first appearance
+}
+
+func (h *house) cell(id int) *Cell {
+	for _, cell := range h.cells {
+		if cell.ID == id {
+			return cell
+		}
+	}
+
+	return nil
+}
+
+// NewServer starts a fake server that serves houses.
+//
+// The server is closed automatically when the test finishes.
+func NewServer(tb testing.TB, houses ...House) *Server {
+	tb.Helper()
+
+	s := &Server{
+		tb:       tb,
+		sessions: make(map[*session]struct{}),
+		requests: make(map[string]int),
+		failures: make(map[string]string),
+	}
+
+	for i, h := range houses {
+		if h.UniqueID == "" {
+			h.UniqueID = fmt.Sprintf("fhometest-%d", i)
+		}
+		if h.FriendlyName == "" {
+			h.FriendlyName = "House"
+		}
+		if h.ResourceType == "" {
+			h.ResourceType = "resource"
+		}
+		if h.ResourcePassword == "" {
+			h.ResourcePassword = ResourcePassword
+		}
+		if h.ProjectVersion == "" {
+			h.ProjectVersion = "1"
+		}
+
+		hs := &house{House: h, passwordHash: passwordHash(h.ResourcePassword)}
+		addCell := func(cell Cell) {
+			if hs.cell(cell.ID) != nil {
+				return
+			}
+
+			if cell.Permission == "" {
+				cell.Permission = "FC"
+			}
+			if cell.ValueStr == "" {
+				cell.ValueStr = valueStr(cell.DisplayType, cell.Value)
+			}
+
+			hs.cells = append(hs.cells, &cell)
+		}
+		for _, panel := range h.Panels {
+			for _, cell := range panel.Cells {
+				addCell(cell)
+			}
+		}
+		for _, cell := range h.Unassigned {
+			addCell(cell)
+		}
+
+		s.houses = append(s.houses, hs)
+	}
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveWS))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/webapp-interface/"
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// Dial returns a client, configured with opts, connected to the server, but
+// without any session open.
+//
+// The client is closed automatically when the test finishes.
+func (s *Server) Dial(tb testing.TB, opts ...api.Option) *api.Client {
+	tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts = append([]api.Option{api.WithURL(s.URL)}, opts...)
+	client, err := api.NewClient(ctx, nil, opts...)
+	if err != nil {
+		tb.Fatalf("fhometest: NewClient() error = %v", err)
+	}
+	tb.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// ConnectCloud is like [Server.Dial], but it also opens the cloud session and
+// gets the resources, so that only the resource session is left to open.
+func (s *Server) ConnectCloud(tb testing.TB, opts ...api.Option) *api.Client {
+	tb.Helper()
+
+	client := s.Dial(tb, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.OpenCloudSession(ctx, Email, Password); err != nil {
+		tb.Fatalf("fhometest: OpenCloudSession() error = %v", err)
+	}
+	if _, err := client.GetMyResources(ctx); err != nil {
+		tb.Fatalf("fhometest: GetMyResources() error = %v", err)
+	}
+
+	return client
+}
+
+// Connect returns a client, configured with opts, with an open resource session
+// to the first house of the server.
+//
+// The client is closed automatically when the test finishes.
+func (s *Server) Connect(tb testing.TB, opts ...api.Option) *api.Client {
+	tb.Helper()
+
+	client := s.ConnectCloud(tb, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.OpenResourceSession(ctx, ResourcePassword); err != nil {
+		tb.Fatalf("fhometest: OpenResourceSession() error = %v", err)
+	}
+
+	return client
+}
+
+// ConnectWithConfig is like [Server.Connect], but it also returns the config of
+// the house, merged from its user and system configs.
+func (s *Server) ConnectWithConfig(tb testing.TB, opts ...api.Option) (*api.Client, *api.Config) {
+	tb.Helper()
+
+	client := s.Connect(tb, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userConfig, err := client.GetUserConfig(ctx)
+	if err != nil {
+		tb.Fatalf("fhometest: GetUserConfig() error = %v", err)
+	}
+	sysConfig, err := client.GetSystemConfig(ctx)
+	if err != nil {
+		tb.Fatalf("fhometest: GetSystemConfig() error = %v", err)
+	}
+	config, err := api.MergeConfigs(userConfig, sysConfig)
+	if err != nil {
+		tb.Fatalf("fhometest: MergeConfigs() error = %v", err)
+	}
+
+	return client, config
+}
+
+// Close closes all connections and shuts down the server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.srv.Close()
+}
+
+// DropConnections abruptly closes all client connections, as if the network
+// went down. The server keeps accepting new connections.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+}
+
+// Disconnect sends the "disconnecting" action with reason and details to all
+// clients and closes their connections.
+func (s *Server) Disconnect(reason, details string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sess := range s.sessions {
+		_ = sess.write(map[string]any{
+			"action_name": api.ActionDisconnecting,
+			"source":      "fhometest",
+			"reason":      reason,
+			"details":     details,
+		})
+		sess.conn.Close()
+	}
+}
+
+// SetSilent makes the server accept connections and read requests, but never
+// respond, as if it hung. Pass false to make it respond again.
+func (s *Server) SetSilent(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.silent = silent
+}
+
+func (s *Server) isSilent() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.silent
+}
+
+// SetTokenlessErrors makes the server leave out the request token from error
+// responses, so that they can only be matched to requests by the action name.
+func (s *Server) SetTokenlessErrors(tokenless bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenlessErrors = tokenless
+}
+
+// FailAction makes the server respond to all following requests with the
+// action with an error with details. Pass "" to make it succeed again.
+func (s *Server) FailAction(action, details string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if details == "" {
+		delete(s.failures, action)
+		return
+	}
+	s.failures[action] = details
+}
+
+// Requests returns the number of requests with the action that the server
+// received.
+func (s *Server) Requests(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[action]
+}
+
+// SetProjectVersion changes the project version of all houses, as if they were
+// reconfigured.
+func (s *Server) SetProjectVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.houses {
+		h.ProjectVersion = version
+	}
+}
+
+// Events returns all events received by the server so far, in order.
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]Event, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// CellValue returns the current value of the cell with id.
+//
+// Houses are searched in order. The second return value reports whether the
+// cell was found.
+func (s *Server) CellValue(id int) (api.CellValue, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.houses {
+		if cell := h.cell(id); cell != nil {
+			return cellValue(cell), true
+		}
+	}
+
+	return api.CellValue{}, false
+}
+
+// SetValue changes the value of the cell with id as if it was changed
+// physically (e.g., with a wall switch) and notifies connected clients.
+func (s *Server) SetValue(id int, value string) {
+	s.tb.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.houses {
+		if cell := h.cell(id); cell != nil {
+			s.update(h, cell, value)
+			return
+		}
+	}
+
+	s.tb.Fatalf("fhometest: no cell with id %d", id)
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.tb.Logf("fhometest: failed to upgrade: %v", err)
+		return
+	}
+
+	sess := &session{conn: conn}
+
+	s.mu.Lock()
+	s.sessions[sess] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	if !s.isSilent() {
+		err = sess.write(map[string]any{
+			"action_name": "authentication_required",
+			"status":      "",
+			"source":      "fhometest",
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req request
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			s.tb.Errorf("fhometest: failed to unmarshal request %s: %v", data, err)
+			return
+		}
+
+		if s.isSilent() {
+			continue
+		}
+
+		resp, after := s.handle(sess, &req)
+		if err := sess.write(resp); err != nil {
+			return
+		}
+
+		if after != nil {
+			after()
+		}
+	}
+}
+
+// request is a union of all messages sent by the client.
+type request struct {
+	ActionName   string `json:"action_name"`
+	RequestToken string `json:"request_token"`
+	Email        string `json:"email"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	UniqueID     string `json:"unique_id"`
+	CellID       string `json:"cell_id"`
+	Value        string `json:"value"`
+	Type         string `json:"type"`
+}
+
+type session struct {
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	// Guarded by Server.mu.
+	email string
+	house *house
+}
+
+func (sess *session) write(v any) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	return sess.conn.WriteJSON(v)
+}
+
+// handle returns the response to req and, optionally, a function to be called
+// after the response is sent.
+func (s *Server) handle(sess *session, req *request) (map[string]any, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := map[string]any{
+		"action_name":   req.ActionName,
+		"request_token": req.RequestToken,
+		"status":        "ok",
+		"source":        "fhometest",
+	}
+
+	fail := func(details string) (map[string]any, func()) {
+		resp["status"] = "error"
+		resp["details"] = details
+		if s.tokenlessErrors {
+			delete(resp, "request_token")
+		}
+		return resp, nil
+	}
+
+	s.requests[req.ActionName]++
+	if details, ok := s.failures[req.ActionName]; ok {
+		return fail(details)
+	}
+
+	switch req.ActionName {
+	case api.ActionOpenClientSession:
+		if req.Email != Email || req.Password != Password {
+			return fail("invalid email or password")
+		}
+		sess.email = req.Email
+		return resp, nil
+	case api.ActionGetMyData:
+		if sess.email == "" || req.Email != sess.email {
+			return fail("not authenticated")
+		}
+		resp["email"] = sess.email
+		return resp, nil
+	case api.ActionGetMyResources:
+		if sess.email == "" || req.Email != sess.email {
+			return fail("not authenticated")
+		}
+		for i, h := range s.houses {
+			resp[fmt.Sprintf("avatar_id_%d", i)] = ""
+			resp[fmt.Sprintf("friendly_name_%d", i)] = h.FriendlyName
+			resp[fmt.Sprintf("resource_type_%d", i)] = h.ResourceType
+			resp[fmt.Sprintf("unique_id_%d", i)] = h.UniqueID
+		}
+		return resp, nil
+	case api.ActionOpenClienToResourceSession:
+		for _, h := range s.houses {
+			if h.UniqueID == req.UniqueID && req.Email == Email {
+				sess.house = h
+				return resp, nil
+			}
+		}
+		return fail("no such resource")
+	}
+
+	// All other actions are sent to the resource and require its password.
+	h := sess.house
+	if h == nil {
+		return fail("no resource session")
+	}
+	if req.Login != Email || req.Password != h.passwordHash {
+		return fail("invalid login or password")
+	}
+
+	switch req.ActionName {
+	case api.ActionGetUserConfig:
+		file, err := json.Marshal(userConfig(h))
+		if err != nil {
+			s.tb.Fatalf("fhometest: failed to marshal user config: %v", err)
+		}
+		resp["file"] = string(file)
+	case api.ActionGetSystemConfig:
+		cells := make([]api.MobileDisplayCell, 0, len(h.cells))
+		for _, cell := range h.cells {
+			cells = append(cells, api.MobileDisplayCell{
+				Desc:        cell.Desc,
+				ID:          strconv.Itoa(cell.ID),
+				TypeNumber:  cell.TypeNumber,
+				Preset:      cell.Preset,
+				Style:       cell.Style,
+				MinValue:    cell.MinValue,
+				MaxValue:    cell.MaxValue,
+				Step:        cell.Step,
+				DisplayType: cell.DisplayType,
+				Permission:  cell.Permission,
+			})
+		}
+		resp["response"] = map[string]any{
+			"ProjectVersion": h.ProjectVersion,
+			"Status":         true,
+			"StatusText":     "",
+			"MobileDisplayProperties": map[string]any{
+				"Cells": cells,
+			},
+		}
+	case api.ActionStatusTouches:
+		values := make([]api.CellValue, 0, len(h.cells))
+		for _, cell := range h.cells {
+			values = append(values, cellValue(cell))
+		}
+		resp["response"] = statusResponse(h, values)
+	case api.ActionEvent:
+		cellID, err := strconv.Atoi(req.CellID)
+		if err != nil {
+			return fail("invalid cell_id")
+		}
+		cell := h.cell(cellID)
+		if cell == nil {
+			return fail("no such cell")
+		}
+
+		s.events = append(s.events, Event{
+			UniqueID: h.UniqueID,
+			CellID:   cellID,
+			Value:    req.Value,
+			Type:     req.Type,
+		})
+
+		if cell.Unresponsive {
+			break
+		}
+
+		value := req.Value
+		if value == api.ValueToggle {
+			value = toggle(cell)
+		}
+
+		// Reply to the sender first, like the real server does.
+		return resp, func() { s.updateLocked(h, cell, value) }
+	case api.ActionSystemStatus:
+		now := time.Now()
+		resp["response"] = map[string]any{
+			"ServerName":     h.FriendlyName,
+			"UUID":           h.UniqueID,
+			"ProjectVersion": h.ProjectVersion,
+			"SystemTime":     now.Format(time.TimeOnly),
+			"SystemDate":     now.Format(time.DateOnly),
+			"HGVersion":      "fhometest",
+			"ProxySupport":   false,
+		}
+	default:
+		return fail("unknown action")
+	}
+
+	return resp, nil
+}
+
+func (s *Server) updateLocked(h *house, cell *Cell, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.update(h, cell, value)
+}
+
+// update sets the value of cell and pushes "statustoucheschanged" to all
+// sessions opened to h if the value has changed.
+//
+// s.mu must be held.
+func (s *Server) update(h *house, cell *Cell, value string) {
+	if cell.Value == value {
+		return
+	}
+
+	cell.Value = value
+	cell.ValueStr = valueStr(cell.DisplayType, value)
+
+	push := map[string]any{
+		"action_name": api.ActionStatusTouchesChanged,
+		"status":      "ok",
+		"source":      "fhometest",
+		"response":    statusResponse(h, []api.CellValue{cellValue(cell)}),
+	}
+
+	for sess := range s.sessions {
+		if sess.house != h {
+			continue
+		}
+
+		// Errors are ignored, the reading goroutine cleans up broken sessions.
+		_ = sess.write(push)
+	}
+}
+
+func statusResponse(h *house, values []api.CellValue) map[string]any {
+	return map[string]any{
+		"ProjectVersion": h.ProjectVersion,
+		"Status":         true,
+		"StatusText":     "",
+		"CV":             values,
+		"ServerTime":     time.Now().Unix(),
+	}
+}
+
+func userConfig(h *house) api.UserConfig {
+	var cfg api.UserConfig
+	cfg.Server.ProjectVersion = h.ProjectVersion
+
+	// maps cell ID to its index in cfg.Cells
+	indexes := make(map[int]int)
+	for i, panel := range h.Panels {
+		cfg.Panels = append(cfg.Panels, api.UserPanel{
+			ID:   panel.ID,
+			Name: panel.Name,
+			X:    i,
+		})
+
+		for j, cell := range panel.Cells {
+			index, ok := indexes[cell.ID]
+			if !ok {
+				index = len(cfg.Cells)
+				indexes[cell.ID] = index
+				cfg.Cells = append(cfg.Cells, api.UserCell{
+					ObjectID: cell.ID,
+					Icon:     string(cell.Icon),
+					Name:     cell.Name,
+				})
+			}
+
+			cfg.Cells[index].PositionInPanel = append(cfg.Cells[index].PositionInPanel, api.PositionInPanel{
+				Orientation: "portrait",
+				PanelID:     panel.ID,
+				X:           j,
+			})
+		}
+	}
+
+	return cfg
+}
+
+func cellValue(cell *Cell) api.CellValue {
+	return api.CellValue{
+		ID:          strconv.Itoa(cell.ID),
+		Ii:          "0",
+		DisplayType: cell.DisplayType,
+		Value:       cell.Value,
+		ValueStr:    cell.ValueStr,
+	}
+}
+
+// toggle returns the value cell has after receiving [api.ValueToggle].
+func toggle(cell *Cell) string {
+	switch cell.DisplayType {
+	case api.Percentage:
+		if cell.Value == api.MapLighting(0) {
+			return api.MapLighting(100)
+		}
+		return api.MapLighting(0)
+	default:
+		// Momentary objects, e.g., gates, don't change their value.
+		return cell.Value
+	}
+}
+
+func valueStr(dt api.DisplayType, value string) string {
+	switch dt {
+	case api.Percentage:
+		if v, err := api.RemapLighting(value); err == nil {
+			return fmt.Sprintf("%d%%", v)
+		}
+	case api.Temperature:
+		if v, err := api.DecodeTemperatureValue(value); err == nil {
+			return strings.ReplaceAll(strconv.FormatFloat(v, 'f', 1, 64), ".", ",") + "°C"
+		}
+	}
+
+	return value
+}
+
+func passwordHash(password string) string {
+	hash := pbkdf2.Key([]byte(password), []byte("fhome123"), 1e4, 32, sha1.New)
+	return base64.StdEncoding.EncodeToString(hash)
+}
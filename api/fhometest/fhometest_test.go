@@ -0,0 +1,206 @@
+package fhometest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/gorilla/websocket"
+)
+
+var testHouse = House{
+	Panels: []Panel{
+		{
+			ID:   "1",
+			Name: "Kitchen",
+			Cells: []Cell{
+				{ID: 300, Name: "Ceiling", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 301, Name: "Thermostat", Icon: api.IconTemperature, DisplayType: api.Temperature, Value: "0xa0fa"},
+			},
+		},
+		{
+			ID:   "2",
+			Name: "Favourites",
+			Cells: []Cell{
+				{ID: 300, Name: "Ceiling", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+			},
+		},
+	},
+}
+
+// dial connects to srv and opens a resource session to its first house.
+func dial(t *testing.T, srv *Server) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var resp api.Response
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("failed to read first message: %v", err)
+	}
+	if resp.ActionName != "authentication_required" {
+		t.Fatalf("first message is %q, want authentication_required", resp.ActionName)
+	}
+
+	roundTrip(t, conn, api.OpenClientToResourceSession{
+		ActionName:   api.ActionOpenClienToResourceSession,
+		Email:        Email,
+		UniqueID:     "fhometest-0",
+		RequestToken: "token",
+	})
+
+	return conn
+}
+
+func roundTrip(t *testing.T, conn *websocket.Conn, req any) []byte {
+	t.Helper()
+
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	var resp api.Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if resp.Status != "ok" {
+		t.Fatalf("status of %s is %q, want ok", resp.ActionName, resp.Status)
+	}
+
+	return data
+}
+
+func action(name string) api.Action {
+	return api.Action{
+		ActionName:   name,
+		Login:        Email,
+		PasswordHash: passwordHash(ResourcePassword),
+		RequestToken: "token",
+	}
+}
+
+func TestServer_OpenClientSession(t *testing.T) {
+	srv := NewServer(t, testHouse)
+
+	conn, _, err := websocket.DefaultDialer.Dial(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	var resp api.Response
+	_ = conn.ReadJSON(&resp)
+
+	err = conn.WriteJSON(api.OpenClientSession{
+		ActionName:   api.ActionOpenClientSession,
+		Email:        Email,
+		Password:     "wrong",
+		RequestToken: "token",
+	})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if resp.Status == "ok" {
+		t.Errorf("status is ok for wrong password")
+	}
+}
+
+func TestServer_GetUserConfig(t *testing.T) {
+	srv := NewServer(t, testHouse)
+	conn := dial(t, srv)
+
+	data := roundTrip(t, conn, action(api.ActionGetUserConfig))
+
+	var resp api.GetUserConfigResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	var userConfig api.UserConfig
+	if err := json.Unmarshal([]byte(resp.File), &userConfig); err != nil {
+		t.Fatalf("failed to unmarshal file: %v", err)
+	}
+
+	if len(userConfig.Panels) != 2 {
+		t.Errorf("got %d panels, want 2", len(userConfig.Panels))
+	}
+	if len(userConfig.Cells) != 2 {
+		t.Errorf("got %d cells, want 2", len(userConfig.Cells))
+	}
+	if got := len(userConfig.GetCellsByPanelID("2")); got != 1 {
+		t.Errorf("got %d cells in panel 2, want 1", got)
+	}
+}
+
+func TestServer_Event(t *testing.T) {
+	srv := NewServer(t, testHouse)
+	conn := dial(t, srv)
+
+	roundTrip(t, conn, api.Event{
+		ActionName:   api.ActionEvent,
+		Login:        Email,
+		PasswordHash: passwordHash(ResourcePassword),
+		RequestToken: "token",
+		CellID:       "300",
+		Value:        api.ValueToggle,
+		Type:         "HEX",
+	})
+
+	var push api.StatusTouchesChangedResponse
+	if err := conn.ReadJSON(&push); err != nil {
+		t.Fatalf("failed to read push: %v", err)
+	}
+	if push.ActionName != api.ActionStatusTouchesChanged {
+		t.Fatalf("got %q, want %q", push.ActionName, api.ActionStatusTouchesChanged)
+	}
+	if len(push.Response.CellValues) != 1 {
+		t.Fatalf("got %d cell values, want 1", len(push.Response.CellValues))
+	}
+	if cv := push.Response.CellValues[0]; cv.ID != "300" || cv.Value != "0x6064" || cv.ValueStr != "100%" {
+		t.Errorf("got cell value %v, want 300 set to 0x6064 (100%%)", cv)
+	}
+
+	events := srv.Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].CellID != 300 || events[0].Value != api.ValueToggle {
+		t.Errorf("got event %+v, want toggle of cell 300", events[0])
+	}
+
+	if cv, _ := srv.CellValue(300); cv.Value != "0x6064" {
+		t.Errorf("got value %s, want 0x6064", cv.Value)
+	}
+}
+
+func TestServer_WrongResourcePassword(t *testing.T) {
+	srv := NewServer(t, testHouse)
+	conn := dial(t, srv)
+
+	a := action(api.ActionStatusTouches)
+	a.PasswordHash = passwordHash("wrong")
+	if err := conn.WriteJSON(a); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	var resp api.Response
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if resp.Status == "ok" {
+		t.Errorf("status is ok for wrong resource password")
+	}
+}
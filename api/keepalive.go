@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// KeepalivePolicy configures how the client checks that the connection to the
+// resource is alive.
+//
+// A half-open connection looks healthy, but never delivers anything. To detect
+// it, the client sends pings, and when no message arrives for IdleTimeout, it
+// probes the resource with "systemstatus". If the probe fails, the connection
+// is considered broken and it's handled according to the reconnect policy.
+type KeepalivePolicy struct {
+	// Interval between websocket pings. Zero disables pings.
+	PingInterval time.Duration
+	// How long the main connection may stay silent before it's probed. Zero
+	// disables the watchdog.
+	IdleTimeout time.Duration
+	// Maximum duration of the probe.
+	ProbeTimeout time.Duration
+}
+
+// DefaultKeepalivePolicy is used by clients created without [WithKeepalive].
+var DefaultKeepalivePolicy = KeepalivePolicy{
+	PingInterval: 30 * time.Second,
+	IdleTimeout:  2 * time.Minute,
+	ProbeTimeout: 10 * time.Second,
+}
+
+// WithKeepalive sets the policy used to check that the connection is alive. A
+// nil policy disables both pings and the watchdog.
+func WithKeepalive(policy *KeepalivePolicy) Option {
+	return func(c *Client) {
+		c.keepalive = policy
+	}
+}
+
+// LastMessageAt returns when the last message was received on the main
+// connection, or the zero time if the resource session isn't open yet.
+//
+// Websocket control frames, like pongs, don't count.
+func (c *Client) LastMessageAt() time.Time {
+	nanos := c.lastMessageAt.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+// RTT returns the round-trip time measured by the last websocket ping, or zero
+// if no pong has been received yet.
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// watchConn prepares conn, a new main connection, to be used by the reader and
+// the keepalive loop.
+func (c *Client) watchConn(conn *websocket.Conn) {
+	c.lastMessageAt.Store(time.Now().UnixNano())
+
+	conn.SetPongHandler(func(appData string) error {
+		sent, err := strconv.ParseInt(appData, 10, 64)
+		if err != nil {
+			// Not a response to our ping.
+			return nil
+		}
+
+		c.rtt.Store(int64(time.Since(time.Unix(0, sent))))
+		return nil
+	})
+}
+
+// keepaliveLoop sends pings and probes the main connection according to the
+// keepalive policy, until the session ends.
+func (c *Client) keepaliveLoop() {
+	policy := c.keepalive
+
+	var pings, checks <-chan time.Time
+	if policy.PingInterval > 0 {
+		ticker := time.NewTicker(policy.PingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	if policy.IdleTimeout > 0 {
+		// Check often enough to notice silence soon after IdleTimeout.
+		ticker := time.NewTicker(policy.IdleTimeout / 4)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-pings:
+			c.ping()
+		case <-checks:
+			if time.Since(c.LastMessageAt()) < policy.IdleTimeout {
+				continue
+			}
+
+			c.probe(policy.ProbeTimeout)
+		}
+	}
+}
+
+// ping sends a websocket ping carrying the time it was sent.
+func (c *Client) ping() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if !c.connected {
+		return
+	}
+
+	data := strconv.FormatInt(time.Now().UnixNano(), 10)
+	err := c.mainConn.WriteControl(websocket.PingMessage, []byte(data), time.Now().Add(writeTimeout))
+	if err != nil {
+		c.breakConn(fmt.Errorf("failed to ping: %w", err))
+	}
+}
+
+// probe sends "systemstatus" to check whether the silent main connection is
+// alive. If it doesn't respond in time, the connection is broken.
+func (c *Client) probe(timeout time.Duration) {
+	c.writeMu.Lock()
+	conn := c.mainConn
+	c.writeMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := c.GetSystemStatus(ctx)
+	var statusErr *StatusError
+	if err == nil || errors.As(err, &statusErr) {
+		// Any response means that the connection is alive.
+		return
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if !c.connected || c.mainConn != conn {
+		// The reader already knows, or even reconnected.
+		return
+	}
+
+	silence := time.Since(c.LastMessageAt()).Round(time.Second)
+	c.breakConn(fmt.Errorf("%w: no messages for %s and probe failed: %w", ErrStale, silence, err))
+}
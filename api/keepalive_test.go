@@ -0,0 +1,66 @@
+package api_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+)
+
+func TestClient_RTT(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t, api.WithKeepalive(&api.KeepalivePolicy{PingInterval: 10 * time.Millisecond}))
+
+	if got := client.LastMessageAt(); time.Since(got) > 5*time.Second {
+		t.Errorf("LastMessageAt() = %v, want recent", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.RTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a pong")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_Watchdog(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t,
+		api.WithReconnect(nil),
+		api.WithKeepalive(&api.KeepalivePolicy{
+			IdleTimeout: 100 * time.Millisecond,
+			// Generous, so that a slow response isn't mistaken for a stale
+			// connection.
+			ProbeTimeout: time.Second,
+		}),
+	)
+
+	// The resource still responds to probes, so the session stays open. Wait
+	// for a response to a probe, the only message the idle resource sends.
+	before := client.LastMessageAt()
+	deadline := time.Now().Add(5 * time.Second)
+	for !client.LastMessageAt().After(before) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a probe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := client.Err(); err != nil {
+		t.Fatalf("Err() = %v while the resource responds", err)
+	}
+
+	srv.SetSilent(true)
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the session to end")
+	}
+
+	if err := client.Err(); !errors.Is(err, api.ErrStale) {
+		t.Errorf("Err() = %v, want ErrStale", err)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -28,7 +29,7 @@ func RemapLighting(value string) (int, error) {
 	value = strings.TrimPrefix(value, "0x")
 	parsed, err := strconv.ParseInt(value, 16, 64)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse int from %s: %v", value, err)
+		return 0, fmt.Errorf("failed to parse int from %s: %w", value, err)
 	}
 
 	parsedValue := int(parsed) - baseLightingValue
@@ -37,28 +38,50 @@ func RemapLighting(value string) (int, error) {
 
 var baseTemperatureValue float64 = 0xa078 - 12*10.0 // 0°C
 
-// EncodeTemperature encodes value to represent the temperature that is ready to be
-// passed to [Client.SendEvent].
+// TemperatureRange is the range of temperatures accepted by a cell.
+type TemperatureRange struct {
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+// DefaultTemperatureRange is used for cells that don't specify their range.
+var DefaultTemperatureRange = TemperatureRange{Min: 12, Max: 28, Step: 0.1}
+
+// Clamp returns value clamped to the range and rounded to the nearest step.
+func (r TemperatureRange) Clamp(value float64) float64 {
+	if r.Step > 0 {
+		value = r.Min + math.Round((value-r.Min)/r.Step)*r.Step
+	}
+
+	return max(r.Min, min(value, r.Max))
+}
+
+// Encode encodes value, clamped to the range, to represent the temperature that
+// is ready to be passed to [Client.SendEvent].
 //
 // Examples of the process:
 //
-// * 12 -> 41080 + 12 * 10 -> 41080 -> "0xa078"
+// * 12 -> 40960 + 12 * 10 -> 41080 -> "0xa078"
 //
-// * 25 -> 41080 + 25 * 10 -> 41210 -> "0xa0fa"
+// * 25 -> 40960 + 25 * 10 -> 41210 -> "0xa0fa"
 //
-// * 28 -> 41080 + 28 * 10 -> 41240 -> "0xa118"
-func EncodeTemperature(value float64) string {
-	if value < 12 {
-		return "0xa078"
-	} else if value > 28 {
-		return "0xa118"
-	}
-
-	v := baseTemperatureValue + value*10
+// * 28 -> 40960 + 28 * 10 -> 41240 -> "0xa118"
+func (r TemperatureRange) Encode(value float64) string {
+	v := baseTemperatureValue + math.Round(r.Clamp(value)*10)
 	fval := "0x" + strconv.FormatInt(int64(v), 16)
 	return fval
 }
 
+// EncodeTemperature encodes value to represent the temperature that is ready to be
+// passed to [Client.SendEvent].
+//
+// Clamps value to [DefaultTemperatureRange]. Prefer [TemperatureRange.Encode]
+// with the range of the cell, see [Cell.TemperatureRange].
+func EncodeTemperature(value float64) string {
+	return DefaultTemperatureRange.Encode(value)
+}
+
 // DecodeTemperatureValue converts hex string to float64 representing
 // temperature in °C.
 //
@@ -73,7 +96,7 @@ func DecodeTemperatureValue(value string) (float64, error) {
 	v := strings.TrimPrefix(value, "0x")
 	parsed, err := strconv.ParseInt(v, 16, 64)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse int from %s: %v", value, err)
+		return 0, fmt.Errorf("failed to parse int from %s: %w", value, err)
 	}
 
 	parsedValue := (float64(parsed) - baseTemperatureValue) / 10
@@ -90,7 +113,7 @@ func DecodeTemperatureValueStr(value string) (float64, error) {
 	v = strings.ReplaceAll(v, ",", ".")
 	parsed, err := strconv.ParseFloat(v, 64)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse float from %s: %v", value, err)
+		return 0, fmt.Errorf("failed to parse float from %s: %w", value, err)
 	}
 
 	return parsed, nil
@@ -73,3 +73,86 @@ func TestRemapLighting(t *testing.T) {
 		})
 	}
 }
+
+func TestTemperatureRangeEncode(t *testing.T) {
+	floorHeating := TemperatureRange{Min: 5, Max: 30, Step: 0.5}
+	sauna := TemperatureRange{Min: 20, Max: 40, Step: 1}
+
+	tests := []struct {
+		name  string
+		r     TemperatureRange
+		value float64
+		want  string
+	}{
+		{
+			name:  "Default range clamps min",
+			r:     DefaultTemperatureRange,
+			value: 5,
+			want:  "0xa078",
+		},
+		{
+			name:  "Default range clamps max",
+			r:     DefaultTemperatureRange,
+			value: 40,
+			want:  "0xa118",
+		},
+		{
+			name:  "Below default min",
+			r:     floorHeating,
+			value: 5,
+			want:  "0xa032",
+		},
+		{
+			name:  "Rounds to step",
+			r:     floorHeating,
+			value: 21.3,
+			want:  "0xa0d7",
+		},
+		{
+			name:  "Above default max",
+			r:     sauna,
+			value: 38.6,
+			want:  "0xa186",
+		},
+		{
+			name:  "Clamps to cell max",
+			r:     sauna,
+			value: 90,
+			want:  "0xa190",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.r.Encode(tt.value)
+			if got != tt.want {
+				t.Errorf("Encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCellTemperatureRange(t *testing.T) {
+	cell := Cell{
+		ID:          400,
+		DisplayType: string(Temperature),
+		MinValue:    "0xa032",
+		MaxValue:    "0xa190",
+		Step:        "0xa005",
+	}
+
+	got, err := cell.TemperatureRange()
+	if err != nil {
+		t.Fatalf("TemperatureRange() error = %v", err)
+	}
+
+	want := TemperatureRange{Min: 5, Max: 40, Step: 0.5}
+	if got != want {
+		t.Errorf("TemperatureRange() = %v, want %v", got, want)
+	}
+
+	cell.DisplayType = string(Percentage)
+	if _, err := cell.TemperatureRange(); err == nil {
+		t.Errorf("TemperatureRange() of %s cell succeeded, want error", Percentage)
+	}
+}
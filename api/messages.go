@@ -28,6 +28,10 @@ const (
 	ActionStatusTouchesChanged = "statustoucheschanged"
 
 	ActionSystemStatus = "systemstatus"
+
+	// ActionDisconnecting is sent by the server right before it ends the
+	// session. See [DisconnectedError].
+	ActionDisconnecting = "disconnecting"
 )
 
 var ValueToggle = "0x4001"
@@ -45,6 +49,12 @@ type GetMyResources struct {
 	RequestToken string `json:"request_token"`
 }
 
+type GetMyData struct {
+	ActionName   string `json:"action_name"`
+	Email        string `json:"email"`
+	RequestToken string `json:"request_token"`
+}
+
 type OpenClientToResourceSession struct {
 	ActionName   string `json:"action_name"`
 	Email        string `json:"email"`
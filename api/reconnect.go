@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnState is the state of the connection to the resource.
+type ConnState int
+
+const (
+	// StateConnected means that the resource session is open.
+	StateConnected ConnState = iota
+	// StateDisconnected means that the connection is broken and the client is
+	// trying to reconnect.
+	StateDisconnected
+	// StateClosed means that the session has ended because of an
+	// unrecoverable error. See [Client.Err].
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnState(%d)", int(s))
+	}
+}
+
+// ReconnectPolicy configures how the client redials after the connection to
+// the resource is broken.
+//
+// The delay before the n-th attempt is MinDelay * 2^(n-1), capped at MaxDelay.
+type ReconnectPolicy struct {
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Maximum number of consecutive attempts. Zero means no limit.
+	MaxAttempts int
+	// Maximum duration of a single attempt, including the whole handshake.
+	// Zero means no limit.
+	Timeout time.Duration
+}
+
+// DefaultReconnectPolicy is used by clients created without [WithReconnect].
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MinDelay: time.Second,
+	MaxDelay: time.Minute,
+	Timeout:  30 * time.Second,
+}
+
+// WithReconnect sets the policy used to reconnect after the connection is
+// broken. A nil policy disables reconnecting.
+func WithReconnect(policy *ReconnectPolicy) Option {
+	return func(c *Client) {
+		c.reconnect = policy
+	}
+}
+
+// WithStateHandler makes the client call handler whenever the state of the
+// connection changes. For [StateDisconnected] and [StateClosed], err is the
+// reason.
+//
+// The handler is called synchronously from the goroutine that reads messages,
+// so it must not block.
+func WithStateHandler(handler func(state ConnState, err error)) Option {
+	return func(c *Client) {
+		c.onStateChange = handler
+	}
+}
+
+func (c *Client) setState(state ConnState, err error) {
+	if c.onStateChange != nil {
+		c.onStateChange(state, err)
+	}
+}
+
+// delay returns the delay before the attempt-th reconnection attempt.
+func (p *ReconnectPolicy) delay(attempt int) time.Duration {
+	d := p.MinDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	return min(d, p.MaxDelay)
+}
+
+// redial reopens the resource session with the stored credentials, retrying
+// according to the reconnect policy.
+//
+// On success, it replaces the connections of c and returns the new main
+// connection.
+func (c *Client) redial() (*websocket.Conn, error) {
+	policy := c.reconnect
+
+	for attempt := 1; ; attempt++ {
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			return nil, fmt.Errorf("gave up after %d attempts", policy.MaxAttempts)
+		}
+
+		select {
+		case <-c.done:
+			return nil, ErrClosed
+		case <-time.After(policy.delay(attempt)):
+		}
+
+		setupConn, mainConn, err := c.attempt(policy.Timeout)
+		if err != nil {
+			c.setState(StateDisconnected, fmt.Errorf("attempt %d: %w", attempt, err))
+			continue
+		}
+
+		c.writeMu.Lock()
+		if c.isClosed() {
+			c.writeMu.Unlock()
+			setupConn.Close()
+			mainConn.Close()
+			return nil, ErrClosed
+		}
+
+		c.setupMu.Lock()
+		c.setupConn.Close()
+		c.setupConn = setupConn
+		c.setupMu.Unlock()
+		c.mainConn.Close()
+		c.mainConn = mainConn
+		c.connected = true
+		c.broken = nil
+		c.writeMu.Unlock()
+		c.watchConn(mainConn)
+
+		return mainConn, nil
+	}
+}
+
+// attempt opens the sessions, giving up after timeout, if it's positive, or
+// when the client is closed.
+func (c *Client) attempt(timeout time.Duration) (setupConn, mainConn *websocket.Conn, err error) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+
+	go func() {
+		select {
+		case <-c.done:
+			cancel(ErrClosed)
+		case <-ctx.Done():
+		}
+	}()
+
+	return c.openSessions(ctx)
+}
+
+// openSessions replays the handshake: open_client_session and
+// get_my_resources on a new setup connection, then
+// open_client_to_resource_session on a new main connection.
+func (c *Client) openSessions(ctx context.Context) (setupConn, mainConn *websocket.Conn, err error) {
+	setupConn, err = c.dialSetup(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = openClientSession(ctx, setupConn, *c.email, *c.password)
+	if err != nil {
+		setupConn.Close()
+		return nil, nil, fmt.Errorf("open client session: %w", err)
+	}
+
+	_, err = getMyResources(ctx, setupConn, *c.email)
+	if err != nil {
+		setupConn.Close()
+		return nil, nil, fmt.Errorf("get my resources: %w", err)
+	}
+
+	mainConn, err = connect(ctx, c.dialer, c.url)
+	if err != nil {
+		setupConn.Close()
+		return nil, nil, fmt.Errorf("connect: %w", err)
+	}
+
+	actionName := ActionOpenClienToResourceSession
+	token := generateRequestToken()
+	err = handshake(ctx, mainConn, actionName, token, OpenClientToResourceSession{
+		ActionName:   actionName,
+		Email:        *c.email,
+		UniqueID:     *c.uniqueID,
+		RequestToken: token,
+	}, nil)
+	if err != nil {
+		setupConn.Close()
+		mainConn.Close()
+		return nil, nil, fmt.Errorf("open resource session: %w", err)
+	}
+
+	return setupConn, mainConn, nil
+}
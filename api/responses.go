@@ -1,9 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
 	"strconv"
+	"time"
 )
 
 // Response is a websocket message sent from the server to the client in
@@ -35,6 +36,77 @@ type GetMyResourcesResponse struct {
 	FriendlyName0 string `json:"friendly_name_0"`
 	ResourceType0 string `json:"resource_type_0"`
 	UniqueID0     string `json:"unique_id_0"`
+
+	// All resources, parsed from the indexed "_N" fields.
+	Resources []Resource `json:"-"`
+}
+
+// Resource is a single installation (e.g., a house) that the user has access
+// to.
+type Resource struct {
+	AvatarID     string
+	FriendlyName string
+	ResourceType string
+	UniqueID     string
+}
+
+func (r *GetMyResourcesResponse) UnmarshalJSON(data []byte) error {
+	type plain GetMyResourcesResponse
+	err := json.Unmarshal(data, (*plain)(r))
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]any
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+
+	field := func(name string, i int) string {
+		v, _ := fields[fmt.Sprintf("%s_%d", name, i)].(string)
+		return v
+	}
+
+	r.Resources = nil
+	for i := 0; ; i++ {
+		if _, ok := fields[fmt.Sprintf("unique_id_%d", i)]; !ok {
+			break
+		}
+
+		r.Resources = append(r.Resources, Resource{
+			AvatarID:     field("avatar_id", i),
+			FriendlyName: field("friendly_name", i),
+			ResourceType: field("resource_type", i),
+			UniqueID:     field("unique_id", i),
+		})
+	}
+
+	return nil
+}
+
+// GetMyDataResponse describes the account of the user.
+//
+// No response has been captured yet, so the fields that describe the account
+// aren't known and are only available in Fields.
+type GetMyDataResponse struct {
+	ActionName   string `json:"action_name"`
+	RequestToken string `json:"request_token"`
+	Status       string `json:"status"`
+	Source       string `json:"source"`
+
+	// All fields of the response, including the ones listed above.
+	Fields map[string]any `json:"-"`
+}
+
+func (r *GetMyDataResponse) UnmarshalJSON(data []byte) error {
+	type plain GetMyDataResponse
+	err := json.Unmarshal(data, (*plain)(r))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &r.Fields)
 }
 
 type TouchesResponse struct {
@@ -112,6 +184,13 @@ type StatusTouchesChangedResponse struct {
 	Source string `json:"source"`
 }
 
+// ServerTime returns the time at which the server sent the response.
+//
+// The ServerTime field is assumed to be a Unix timestamp in seconds.
+func (r *StatusTouchesChangedResponse) ServerTime() time.Time {
+	return time.Unix(int64(r.Response.ServerTime), 0)
+}
+
 type SystemStatusResponse struct {
 	ActionName string `json:"action_name"`
 	Response   struct {
@@ -136,10 +215,23 @@ type CellValue struct {
 	ValueStr    string      `json:"DVS"` // Probably "data value string"
 }
 
-func (cv CellValue) IntID() int {
+// ParseID returns the ID of the cell as int.
+func (cv CellValue) ParseID() (int, error) {
 	i, err := strconv.Atoi(cv.ID)
 	if err != nil {
-		log.Fatalln("failed to convert ID to int:", err)
+		return 0, fmt.Errorf("failed to convert ID %q to int: %w", cv.ID, err)
+	}
+
+	return i, nil
+}
+
+// IntID returns the ID of the cell as int, or -1 if it's not a number.
+//
+// Deprecated: Use [CellValue.ParseID], which reports malformed IDs.
+func (cv CellValue) IntID() int {
+	i, err := cv.ParseID()
+	if err != nil {
+		return -1
 	}
 
 	return i
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Status is a snapshot of the live values of all cells.
+type Status struct {
+	ProjectVersion string
+	// Time of the snapshot, as reported by the server.
+	ServerTime time.Time
+	// Maps cell ID to its state.
+	Cells map[int]CellState
+}
+
+// CellState is the live value of a single cell.
+type CellState struct {
+	CellValue
+
+	// Decoded value, as returned by [Decode]. It is nil for values that can't
+	// be decoded.
+	Decoded any
+}
+
+// Percent returns the value of a [Percentage] cell.
+func (s CellState) Percent() (int, bool) {
+	v, ok := s.Decoded.(Percent)
+	return int(v), ok
+}
+
+// Celsius returns the value of a [Temperature] cell.
+func (s CellState) Celsius() (float64, bool) {
+	v, ok := s.Decoded.(Celsius)
+	return float64(v), ok
+}
+
+// GetStatus returns the live values of all cells.
+//
+// This action is named "statustouches" in F&Home's terminology.
+func (c *Client) GetStatus(ctx context.Context) (*Status, error) {
+	msg, err := c.SendAction(ctx, ActionStatusTouches)
+	if err != nil {
+		return nil, fmt.Errorf("send %s: %w", ActionStatusTouches, err)
+	}
+
+	var resp StatusTouchesChangedResponse
+	err = json.Unmarshal(msg.Raw, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s response: %w", ActionStatusTouches, err)
+	}
+
+	return ParseStatus(&resp)
+}
+
+// ParseStatus creates [Status] from the response to "statustouches" or from
+// "statustoucheschanged". In the latter case, it contains only the changed
+// cells.
+func ParseStatus(resp *StatusTouchesChangedResponse) (*Status, error) {
+	status := Status{
+		ProjectVersion: resp.Response.ProjectVersion,
+		ServerTime:     resp.ServerTime(),
+		Cells:          make(map[int]CellState, len(resp.Response.CellValues)),
+	}
+
+	for _, cv := range resp.Response.CellValues {
+		id, err := cv.ParseID()
+		if err != nil {
+			return nil, err
+		}
+
+		status.Cells[id] = CellState{CellValue: cv, Decoded: decode(cv)}
+	}
+
+	return &status, nil
+}
+
+// ApplyStatus sets Value and ValueStr of cells of c to their live values from
+// status. Cells missing from status are left unchanged.
+func (c *Config) ApplyStatus(status *Status) {
+	for i := range c.Panels {
+		panel := &c.Panels[i]
+		for j := range panel.Cells {
+			cell := &panel.Cells[j]
+			state, ok := status.Cells[cell.ID]
+			if !ok {
+				continue
+			}
+
+			cell.Value = state.Value
+			cell.ValueStr = state.ValueStr
+		}
+	}
+}
+
+// decode returns the typed value of cv, or nil if it can't be decoded.
+func decode(cv CellValue) any {
+	v, err := Decode(cv)
+	if err != nil {
+		return nil
+	}
+
+	return v
+}
@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+)
+
+func TestClient_GetStatus(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srv.SetValue(301, "0x6032")
+
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+
+	if got := len(status.Cells); got != 4 {
+		t.Errorf("got %d cells, want 4", got)
+	}
+	if status.ServerTime.IsZero() {
+		t.Error("ServerTime is zero")
+	}
+
+	if got, ok := status.Cells[301].Percent(); !ok || got != 50 {
+		t.Errorf("Percent() of cell 301 = %d, %t, want 50, true", got, ok)
+	}
+	if got, ok := status.Cells[400].Celsius(); !ok || got != 25 {
+		t.Errorf("Celsius() of cell 400 = %g, %t, want 25, true", got, ok)
+	}
+}
+
+func TestClient_TakeSessionStatus(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	status := client.TakeSessionStatus()
+	if status == nil {
+		t.Fatal("TakeSessionStatus() = nil after connecting")
+	}
+	if got := len(status.Response.CellValues); got != 4 {
+		t.Errorf("got %d cells, want 4", got)
+	}
+	if client.TakeSessionStatus() != nil {
+		t.Error("TakeSessionStatus() returned the status twice")
+	}
+	if got := srv.Requests(api.ActionStatusTouches); got != 1 {
+		t.Errorf("server got %d %s requests, want 1", got, api.ActionStatusTouches)
+	}
+}
+
+func TestConfig_ApplyStatus(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userConfig, err := client.GetUserConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetUserConfig() error = %v", err)
+	}
+
+	sysConfig, err := client.GetSystemConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetSystemConfig() error = %v", err)
+	}
+
+	cfg, err := api.MergeConfigs(userConfig, sysConfig)
+	if err != nil {
+		t.Fatalf("MergeConfigs() error = %v", err)
+	}
+
+	cell, err := cfg.GetCellByID(400)
+	if err != nil {
+		t.Fatalf("GetCellByID() error = %v", err)
+	}
+	if cell.Value != "" {
+		t.Errorf("Value before ApplyStatus() = %q, want empty", cell.Value)
+	}
+
+	status, err := client.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+
+	cfg.ApplyStatus(status)
+
+	if cell.Value != "0xa0fa" || cell.ValueStr == "" {
+		t.Errorf("got Value %q and ValueStr %q, want 0xa0fa and non-empty", cell.Value, cell.ValueStr)
+	}
+	if cell.Step != "0xa005" {
+		t.Errorf("Step = %q, want 0xa005", cell.Step)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// subscriptionBufferSize is the number of messages buffered for a single
+// subscription.
+const subscriptionBufferSize = 64
+
+// CellFilter selects cells whose value changes are delivered by
+// [Client.Subscribe].
+//
+// A cell matches the filter if it matches all non-empty fields. The zero
+// CellFilter matches all cells.
+type CellFilter struct {
+	CellIDs      []int
+	DisplayTypes []DisplayType
+	// Only cells placed in this panel.
+	Panel *Panel
+}
+
+func (f *CellFilter) matches(cv CellValue) bool {
+	if len(f.DisplayTypes) > 0 && !slices.Contains(f.DisplayTypes, cv.DisplayType) {
+		return false
+	}
+
+	if len(f.CellIDs) == 0 && f.Panel == nil {
+		return true
+	}
+
+	id, err := cv.ParseID()
+	if err != nil {
+		return false
+	}
+
+	if len(f.CellIDs) > 0 && !slices.Contains(f.CellIDs, id) {
+		return false
+	}
+
+	if f.Panel != nil {
+		if _, err := f.Panel.GetCellByID(id); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CellChange is a change of values of one or more cells, pushed by the server
+// in "statustoucheschanged".
+type CellChange struct {
+	// Time of the change, as reported by the server.
+	ServerTime time.Time
+	// New values of all cells in the push that match the filter.
+	Values []CellValue
+}
+
+// Subscribe returns a channel that receives changes of cells matching filter.
+//
+// Every subscription receives all changes independently of other subscriptions
+// and of [Client.ReadMessage]. If the receiver falls far behind, the oldest
+// changes are dropped.
+//
+// The channel is closed when ctx is done or the session ends.
+func (c *Client) Subscribe(ctx context.Context, filter CellFilter) <-chan CellChange {
+	messages, unsubscribe := c.subscribe(subscriptionBufferSize)
+	changes := make(chan CellChange)
+
+	go func() {
+		defer close(changes)
+		defer unsubscribe()
+
+		for {
+			var msg Message
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case msg = <-messages:
+			}
+
+			if msg.ActionName != ActionStatusTouchesChanged {
+				continue
+			}
+
+			var resp StatusTouchesChangedResponse
+			err := json.Unmarshal(msg.Raw, &resp)
+			if err != nil {
+				continue
+			}
+
+			change := CellChange{ServerTime: resp.ServerTime()}
+			for _, cv := range resp.Response.CellValues {
+				if filter.matches(cv) {
+					change.Values = append(change.Values, cv)
+				}
+			}
+
+			if len(change.Values) == 0 {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case changes <- change:
+			}
+		}
+	}()
+
+	return changes
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+)
+
+func TestClient_Subscribe(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	all := client.Subscribe(ctx, api.CellFilter{})
+	hall := client.Subscribe(ctx, api.CellFilter{CellIDs: []int{301}})
+	temps := client.Subscribe(ctx, api.CellFilter{DisplayTypes: []api.DisplayType{api.Temperature}})
+
+	srv.SetValue(300, "0x6010")
+	srv.SetValue(301, "0x6020")
+	srv.SetValue(400, "0xa0f0")
+
+	receive := func(changes <-chan api.CellChange) api.CellValue {
+		t.Helper()
+
+		select {
+		case change := <-changes:
+			if len(change.Values) != 1 {
+				t.Fatalf("got %d values, want 1", len(change.Values))
+			}
+			if change.ServerTime.IsZero() {
+				t.Error("ServerTime is zero")
+			}
+			return change.Values[0]
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for change")
+			return api.CellValue{}
+		}
+	}
+
+	for _, want := range []string{"300", "301", "400"} {
+		if got := receive(all); got.ID != want {
+			t.Errorf("all: got change of cell %s, want %s", got.ID, want)
+		}
+	}
+
+	if got := receive(hall); got.ID != "301" || got.Value != "0x6020" {
+		t.Errorf("hall: got %v, want cell 301 set to 0x6020", got)
+	}
+
+	if got := receive(temps); got.ID != "400" {
+		t.Errorf("temps: got change of cell %s, want 400", got.ID)
+	}
+
+	cancel()
+	if _, ok := <-all; ok {
+		t.Error("channel is not closed after the context is done")
+	}
+}
+
+func TestClient_SetAndConfirm(t *testing.T) {
+	house := fhometest.House{
+		Panels: []fhometest.Panel{
+			{ID: "1", Name: "Ground floor", Cells: []fhometest.Cell{
+				{ID: 300, Name: "Kitchen", DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 301, Name: "Hall", DisplayType: api.Percentage, Value: "0x6000", Unresponsive: true},
+			}},
+		},
+	}
+	srv := fhometest.NewServer(t, house)
+	client := srv.Connect(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cv, err := client.SetAndConfirm(ctx, 300, "0x6032")
+	if err != nil {
+		t.Fatalf("SetAndConfirm() error = %v", err)
+	}
+	if cv.ID != "300" || cv.Value != "0x6032" {
+		t.Errorf("SetAndConfirm() = %+v, want cell 300 set to 0x6032", cv)
+	}
+
+	cv, err = client.SetAndConfirm(ctx, 300, api.ValueToggle)
+	if err != nil {
+		t.Fatalf("SetAndConfirm() toggle error = %v", err)
+	}
+	if cv.Value != "0x6000" {
+		t.Errorf("SetAndConfirm() toggle = %s, want 0x6000", cv.Value)
+	}
+
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	_, err = client.SetAndConfirm(shortCtx, 301, "0x6032")
+	if !errors.Is(err, api.ErrNotConfirmed) {
+		t.Errorf("SetAndConfirm() error = %v, want ErrNotConfirmed", err)
+	}
+	if got := srv.Events(); len(got) != 3 || got[2].CellID != 301 {
+		t.Errorf("got events %+v, want the last one sent to cell 301", got)
+	}
+}
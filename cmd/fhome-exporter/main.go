@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -13,6 +12,7 @@ import (
 	"time"
 
 	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/devices"
 	"github.com/bartekpacia/fhome/highlevel"
 	"github.com/bartekpacia/fhome/internal"
 	"github.com/lmittmann/tint"
@@ -42,6 +42,8 @@ func main() {
 				Name:  "debug",
 				Usage: "show debug logs",
 			},
+			internal.ResourceFlag,
+			internal.UnassignedFlag,
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			var level slog.Level
@@ -73,7 +75,7 @@ func main() {
 }
 
 func run(ctx context.Context, cmd *cli.Command) error {
-	config := internal.Load()
+	config := internal.LoadWithFlags(cmd)
 	port := cmd.Int("port")
 
 	apiClient, err := highlevel.Connect(ctx, config, nil)
@@ -81,7 +83,7 @@ func run(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("connect to fhome: %v", err)
 	}
 
-	apiConfig, err := highlevel.GetConfigs(ctx, apiClient)
+	apiConfig, err := highlevel.GetConfigs(ctx, apiClient, config.MergeOptions()...)
 	if err != nil {
 		return fmt.Errorf("get configs: %v", err)
 	}
@@ -94,7 +96,6 @@ func run(ctx context.Context, cmd *cli.Command) error {
 	tempCells := filterTemperatureCells(apiConfig)
 	slog.Info("found temperature cells", slog.Int("count", len(tempCells)))
 
-	// TODO: api.Client is not concurrency-safe; add a mutex if concurrent scrapes become an issue
 	// TODO: consider background polling if scrape latency becomes a problem
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
@@ -140,7 +141,9 @@ func filterTemperatureCells(cfg *api.Config) []tempCell {
 	var cells []tempCell
 	for _, panel := range cfg.Panels {
 		for _, cell := range panel.Cells {
-			if cell.DisplayType != string(api.Temperature) {
+			switch devices.Classify(cell).Kind() {
+			case devices.KindThermostat, devices.KindTemperatureSensor:
+			default:
 				continue
 			}
 			cells = append(cells, tempCell{
@@ -154,26 +157,13 @@ func filterTemperatureCells(cfg *api.Config) []tempCell {
 }
 
 func handleMetrics(ctx context.Context, w http.ResponseWriter, client *api.Client, tempCells []tempCell) {
-	msg, err := client.SendAction(ctx, api.ActionStatusTouches)
+	status, err := client.GetStatus(ctx)
 	if err != nil {
-		// TODO: implement reconnection logic
-		slog.Error("failed to send statustouches", slog.Any("error", err))
+		slog.Error("failed to get status", slog.Any("error", err))
 		http.Error(w, "failed to collect metrics", http.StatusServiceUnavailable)
 		return
 	}
 
-	var resp api.StatusTouchesChangedResponse
-	if err := json.Unmarshal(msg.Raw, &resp); err != nil {
-		slog.Error("failed to unmarshal statustouches response", slog.Any("error", err))
-		http.Error(w, "failed to collect metrics", http.StatusServiceUnavailable)
-		return
-	}
-
-	cellValues := make(map[string]api.CellValue, len(resp.Response.CellValues))
-	for _, cv := range resp.Response.CellValues {
-		cellValues[cv.ID] = cv
-	}
-
 	// TODO: consider prometheus/client_golang if more metrics are added
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 
@@ -181,18 +171,17 @@ func handleMetrics(ctx context.Context, w http.ResponseWriter, client *api.Clien
 	fmt.Fprintln(w, "# TYPE fhome_room_temperature_celsius gauge")
 
 	for _, tc := range tempCells {
-		cellValue, ok := cellValues[strconv.Itoa(tc.CellID)]
+		state, ok := status.Cells[tc.CellID]
 		if !ok {
 			slog.Debug("no value for temperature cell", slog.Int("cell_id", tc.CellID), slog.String("name", tc.CellName))
 			continue
 		}
 
-		temp, err := api.DecodeTemperatureValueStr(cellValue.ValueStr)
-		if err != nil {
+		temp, ok := state.Celsius()
+		if !ok {
 			slog.Warn("failed to decode temperature",
 				slog.Int("cell_id", tc.CellID),
-				slog.String("value_str", cellValue.ValueStr),
-				slog.Any("error", err),
+				slog.String("value_str", state.ValueStr),
 			)
 			continue
 		}
@@ -201,4 +190,14 @@ func handleMetrics(ctx context.Context, w http.ResponseWriter, client *api.Clien
 			tc.PanelName, tc.CellName, strconv.Itoa(tc.CellID), temp,
 		)
 	}
+
+	fmt.Fprintln(w, "# HELP fhome_last_message_timestamp_seconds Time of the last message received from F&Home")
+	fmt.Fprintln(w, "# TYPE fhome_last_message_timestamp_seconds gauge")
+	fmt.Fprintf(w, "fhome_last_message_timestamp_seconds %d\n", client.LastMessageAt().Unix())
+
+	if rtt := client.RTT(); rtt > 0 {
+		fmt.Fprintln(w, "# HELP fhome_rtt_seconds Round-trip time of the last websocket ping to F&Home")
+		fmt.Fprintln(w, "# TYPE fhome_rtt_seconds gauge")
+		fmt.Fprintf(w, "fhome_rtt_seconds %g\n", rtt.Seconds())
+	}
 }
@@ -9,16 +9,23 @@ import (
 	"strings"
 
 	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/devices"
 	"github.com/brutella/hap"
 	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
 )
 
 type OnLightbulbUpdated func(ID int, v bool)
 
 type OnLEDUpdate func(ID int, brightness int)
 
+type OnColorUpdated func(ID int, color api.Color)
+
 type OnGarageDoorUpdated func(ID int)
 
+type OnBlindUpdated func(ID int, position int)
+
 type OnThermostatUpdated func(ID int, v float64)
 
 type Client struct {
@@ -26,15 +33,56 @@ type Client struct {
 	Name               string
 	OnLightbulbUpdate  OnLightbulbUpdated
 	OnLEDUpdate        OnLEDUpdate
+	OnColorUpdate      OnColorUpdated
 	OnGarageDoorUpdate OnGarageDoorUpdated
+	OnBlindUpdate      OnBlindUpdated
 	OnThermostatUpdate OnThermostatUpdated
+
+	// Whether to expose devices that are set with values that are not
+	// confirmed, see [devices.Unconfirmed].
+	Experimental bool
+}
+
+// DimmableLightbulb is a lightbulb with brightness, but without color.
+type DimmableLightbulb struct {
+	*accessory.A
+	Lightbulb  *service.Lightbulb
+	Brightness *characteristic.Brightness
+}
+
+func newDimmableLightbulb(info accessory.Info) *DimmableLightbulb {
+	a := DimmableLightbulb{}
+	a.A = accessory.New(info, accessory.TypeLightbulb)
+
+	a.Lightbulb = service.NewLightbulb()
+	a.Brightness = characteristic.NewBrightness()
+	a.Lightbulb.AddC(a.Brightness.C)
+	a.AddS(a.Lightbulb.S)
+
+	return &a
 }
 
 type Home struct {
-	Lightbulbs        map[int]*accessory.Lightbulb
-	ColoredLightbulbs map[int]*accessory.ColoredLightbulb
-	GarageDoors       map[int]*accessory.GarageDoorOpener
-	Thermostats       map[int]*accessory.Thermostat
+	Lightbulbs         map[int]*accessory.Lightbulb
+	DimmableLightbulbs map[int]*DimmableLightbulb
+	RGBLightbulbs      map[int]*accessory.ColoredLightbulb
+	GarageDoors        map[int]*accessory.GarageDoorOpener
+	Thermostats        map[int]*accessory.Thermostat
+	TemperatureSensors map[int]*accessory.Thermometer
+	Blinds             map[int]*accessory.WindowCovering
+
+	server *hap.Server
+}
+
+// Start starts serving the accessories to HomeKit in the background, until ctx
+// is done. Callbacks of [Client] are only called after Start.
+func (h *Home) Start(ctx context.Context) {
+	go func() {
+		err := h.server.ListenAndServe(ctx)
+		if err != nil {
+			slog.Error("failed to start HAP server", slog.Any("error", err))
+		}
+	}()
 }
 
 func (c *Client) SetUp(cfg *api.Config) (*Home, error) {
@@ -42,75 +90,164 @@ func (c *Client) SetUp(cfg *api.Config) (*Home, error) {
 
 	// maps cellID to lightbulbs
 	lightbulbMap := make(map[int]*accessory.Lightbulb)
-	coloredLightbulbs := make(map[int]*accessory.ColoredLightbulb)
+	dimmableLightbulbs := make(map[int]*DimmableLightbulb)
+	rgbLightbulbs := make(map[int]*accessory.ColoredLightbulb)
 	thermostatsMap := make(map[int]*accessory.Thermostat)
 	garageDoorMap := make(map[int]*accessory.GarageDoorOpener)
-	for _, panel := range cfg.Panels {
-		for _, cell := range panel.Cells {
-
-			accessoryInfo := accessory.Info{Name: strings.TrimSpace(cell.Name)}
-			if cell.Icon == api.IconLighting {
-				if strings.Contains(cell.Name, "LED") {
-					a := accessory.NewColoredLightbulb(accessoryInfo)
-					coloredLightbulbs[cell.ID] = a
-
-					a.Lightbulb.On.OnValueRemoteUpdate(func(on bool) {
-						var val int
-						if on {
-							val = 100
-						}
-
-						c.OnLEDUpdate(cell.ID, val)
-					})
-
-					a.Lightbulb.Brightness.OnValueRemoteUpdate(func(v int) {
-						c.OnLEDUpdate(cell.ID, v)
-					})
-
-					accessories = append(accessories, a.A)
-				} else {
-					a := accessory.NewLightbulb(accessoryInfo)
-					lightbulbMap[cell.ID] = a
-
-					a.Lightbulb.On.OnValueRemoteUpdate(func(v bool) {
-						c.OnLightbulbUpdate(cell.ID, v)
-					})
-
-					accessories = append(accessories, a.A)
+	temperatureSensors := make(map[int]*accessory.Thermometer)
+	blinds := make(map[int]*accessory.WindowCovering)
+	for _, device := range devices.FromConfig(cfg) {
+		cell := device.Cell()
+		accessoryInfo := accessory.Info{Name: strings.TrimSpace(cell.Name)}
+
+		if !c.Experimental && devices.Unconfirmed(device) {
+			slog.Debug("no accessory for cell set with unconfirmed values",
+				slog.Int("id", cell.ID),
+				slog.String("name", cell.Name),
+				slog.String("kind", device.Kind().String()),
+			)
+			continue
+		}
+
+		switch device := device.(type) {
+		case *devices.RGBLight:
+			a := accessory.NewColoredLightbulb(accessoryInfo)
+			rgbLightbulbs[cell.ID] = a
+
+			// HomeKit changes characteristics one by one, so every change
+			// sends the color made of the current values of all of them.
+			sendColor := func() {
+				var v float64
+				if a.Lightbulb.On.Value() {
+					v = float64(a.Lightbulb.Brightness.Value())
 				}
+
+				color := api.ColorFromHSV(a.Lightbulb.Hue.Value(), a.Lightbulb.Saturation.Value(), v)
+				c.OnColorUpdate(cell.ID, color)
 			}
-			if cell.Icon == api.IconTemperature {
-				a := accessory.NewThermostat(accessoryInfo)
-				thermostatsMap[cell.ID] = a
 
-				a.Thermostat.TargetTemperature.Val = 12
-				a.Thermostat.TargetTemperature.MinVal = 12
-				a.Thermostat.TargetTemperature.MaxVal = 28
+			a.Lightbulb.On.OnValueRemoteUpdate(func(on bool) {
+				if on && a.Lightbulb.Brightness.Value() == 0 {
+					a.Lightbulb.Brightness.SetValue(100)
+				}
+				sendColor()
+			})
+			a.Lightbulb.Brightness.OnValueRemoteUpdate(func(int) { sendColor() })
+			a.Lightbulb.Hue.OnValueRemoteUpdate(func(float64) { sendColor() })
+			a.Lightbulb.Saturation.OnValueRemoteUpdate(func(float64) { sendColor() })
+
+			accessories = append(accessories, a.A)
+		case *devices.Dimmer:
+			a := newDimmableLightbulb(accessoryInfo)
+			dimmableLightbulbs[cell.ID] = a
+
+			a.Lightbulb.On.OnValueRemoteUpdate(func(on bool) {
+				var val int
+				if on {
+					val = 100
+				}
 
-				currentTemp, err := api.DecodeTemperatureValue(cell.Value)
+				c.OnLEDUpdate(cell.ID, val)
+			})
+
+			a.Brightness.OnValueRemoteUpdate(func(v int) {
+				c.OnLEDUpdate(cell.ID, v)
+			})
+
+			accessories = append(accessories, a.A)
+		case *devices.Switch:
+			a := accessory.NewLightbulb(accessoryInfo)
+			lightbulbMap[cell.ID] = a
+
+			a.Lightbulb.On.OnValueRemoteUpdate(func(v bool) {
+				c.OnLightbulbUpdate(cell.ID, v)
+			})
+
+			accessories = append(accessories, a.A)
+		case *devices.Thermostat:
+			r, err := device.Range()
+			if err != nil {
+				slog.Error("no accessory for thermostat with malformed range",
+					slog.Int("id", cell.ID),
+					slog.String("name", cell.Name),
+					slog.Any("error", err),
+				)
+				continue
+			}
+
+			a := accessory.NewThermostat(accessoryInfo)
+			thermostatsMap[cell.ID] = a
+
+			a.Thermostat.TargetTemperature.Val = r.Min
+			a.Thermostat.TargetTemperature.MinVal = r.Min
+			a.Thermostat.TargetTemperature.MaxVal = r.Max
+			if r.Step > 0 {
+				a.Thermostat.TargetTemperature.StepVal = r.Step
+			}
+
+			// The value is unknown if the config was created without the
+			// live state.
+			if cell.Value != "" {
+				decoded, err := api.Decode(api.CellValue{
+					DisplayType: api.Temperature,
+					Value:       cell.Value,
+					ValueStr:    cell.ValueStr,
+				})
 				if err != nil {
 					return nil, fmt.Errorf("failed to remap temperature: %v", err)
 				}
 
+				currentTemp := float64(decoded.(api.Celsius))
 				a.Thermostat.CurrentTemperature.Val = currentTemp
+				a.Thermostat.TargetTemperature.Val = r.Clamp(currentTemp)
+			}
 
-				a.Thermostat.TargetTemperature.OnValueRemoteUpdate(func(v float64) {
-					c.OnThermostatUpdate(cell.ID, v)
-				})
+			a.Thermostat.TargetTemperature.OnValueRemoteUpdate(func(v float64) {
+				c.OnThermostatUpdate(cell.ID, v)
+			})
 
-				accessories = append(accessories, a.A)
-			}
+			accessories = append(accessories, a.A)
+		case *devices.TemperatureSensor:
+			a := accessory.NewTemperatureSensor(accessoryInfo)
+			temperatureSensors[cell.ID] = a
 
-			if cell.Icon == api.IconGate {
-				a := accessory.NewGarageDoorOpener(accessoryInfo)
-				garageDoorMap[cell.ID] = a
+			if temp, err := device.Temperature(); err == nil {
+				a.TempSensor.CurrentTemperature.Val = temp
+			}
 
-				a.GarageDoorOpener.TargetDoorState.OnValueRemoteUpdate(func(v int) {
-					c.OnGarageDoorUpdate(cell.ID)
-				})
+			accessories = append(accessories, a.A)
+		case *devices.Blind:
+			a := accessory.NewWindowCovering(accessoryInfo)
+			blinds[cell.ID] = a
 
-				accessories = append(accessories, a.A)
+			if position, err := device.Position(); err == nil {
+				a.WindowCovering.CurrentPosition.Val = position
+				a.WindowCovering.TargetPosition.Val = position
 			}
+			a.WindowCovering.PositionState.Val = characteristic.PositionStateStopped
+
+			a.WindowCovering.TargetPosition.OnValueRemoteUpdate(func(v int) {
+				c.OnBlindUpdate(cell.ID, v)
+			})
+
+			accessories = append(accessories, a.A)
+		case *devices.Gate:
+			a := accessory.NewGarageDoorOpener(accessoryInfo)
+			garageDoorMap[cell.ID] = a
+
+			// Gates are controlled with an impulse, so any change of the
+			// target state is sent the same way.
+			a.GarageDoorOpener.TargetDoorState.OnValueRemoteUpdate(func(v int) {
+				c.OnGarageDoorUpdate(cell.ID)
+			})
+
+			accessories = append(accessories, a.A)
+		default:
+			slog.Debug("no accessory for cell",
+				slog.Int("id", cell.ID),
+				slog.String("name", cell.Name),
+				slog.String("kind", device.Kind().String()),
+			)
 		}
 	}
 
@@ -123,17 +260,14 @@ func (c *Client) SetUp(cfg *api.Config) (*Home, error) {
 	}
 	server.Pin = c.PIN
 
-	go func() {
-		err := server.ListenAndServe(context.Background())
-		if err != nil {
-			slog.Error("failed to start HAP server", slog.Any("error", err))
-		}
-	}()
-
 	return &Home{
-		Lightbulbs:        lightbulbMap,
-		ColoredLightbulbs: coloredLightbulbs,
-		GarageDoors:       garageDoorMap,
-		Thermostats:       thermostatsMap,
+		Lightbulbs:         lightbulbMap,
+		DimmableLightbulbs: dimmableLightbulbs,
+		RGBLightbulbs:      rgbLightbulbs,
+		GarageDoors:        garageDoorMap,
+		Thermostats:        thermostatsMap,
+		TemperatureSensors: temperatureSensors,
+		Blinds:             blinds,
+		server:             server,
 	}, nil
 }
@@ -2,17 +2,21 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/bartekpacia/fhome/api"
 	"github.com/bartekpacia/fhome/cmd/fhome-homekit/homekit"
+	"github.com/bartekpacia/fhome/devices"
 	"github.com/bartekpacia/fhome/highlevel"
 	"github.com/bartekpacia/fhome/internal"
+	"github.com/brutella/hap/characteristic"
 	"github.com/lmittmann/tint"
 	"github.com/urfave/cli/v3"
 )
@@ -46,6 +50,8 @@ func main() {
 				Usage: "PIN of the HomeKit bridge accessory",
 				Value: "00102003",
 			},
+			internal.ResourceFlag,
+			internal.UnassignedFlag,
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			var level slog.Level
@@ -84,14 +90,14 @@ func run(ctx context.Context, cmd *cli.Command) error {
 	name := cmd.String("homekit-name")
 	pin := cmd.String("homekit-pin")
 
-	config := internal.Load()
+	config := internal.LoadWithFlags(cmd)
 
 	apiClient, err := highlevel.Connect(ctx, config, nil)
 	if err != nil {
 		return fmt.Errorf("connect to fhome: %v", err)
 	}
 
-	apiConfig, err := highlevel.GetConfigs(ctx, apiClient)
+	apiConfig, err := highlevel.GetConfigsWithState(ctx, apiClient, config.MergeOptions()...)
 	if err != nil {
 		return fmt.Errorf("get configs: %v", err)
 	}
@@ -101,55 +107,135 @@ func run(ctx context.Context, cmd *cli.Command) error {
 		slog.Int("cells", len(apiConfig.Cells())),
 	)
 
-	return homekitSyncer(ctx, apiClient, apiConfig, name, pin)
+	return homekitSyncer(ctx, apiClient, apiConfig, name, pin, config.Experimental)
 }
 
-func homekitSyncer(ctx context.Context, fhomeClient *api.Client, apiConfig *api.Config, name, pin string) error {
+func homekitSyncer(ctx context.Context, fhomeClient *api.Client, apiConfig *api.Config, name, pin string, experimental bool) error {
 	slog.Debug("starting homekit syncer")
 
 	// HomeKit -> F&Home
 	//
 	// Here we listen to events from HomeKit and convert them to API calls to
 	// F&Home to keep the state in sync.
+	devicesByID := make(map[int]devices.Device)
+	for _, device := range devices.FromConfig(apiConfig) {
+		devicesByID[device.Cell().ID] = device
+	}
+
+	// home is set before HomeKit is served, so callbacks always see it.
+	var home *homekit.Home
+
+	// known holds the last value of each cell reported by F&Home. syncMu
+	// guards it and serializes updates of accessories, which come both from
+	// F&Home and from failed callbacks.
+	var (
+		syncMu sync.Mutex
+		known  = make(map[int]api.CellValue)
+	)
+	update := func(cellValue api.CellValue) {
+		syncMu.Lock()
+		defer syncMu.Unlock()
+
+		if cellID, err := cellValue.ParseID(); err == nil {
+			known[cellID] = cellValue
+		}
+		syncCellValue(home, apiConfig, cellValue)
+	}
+
+	// failed logs that an event couldn't be sent and restores the accessory to
+	// the last known state of the cell, so that HomeKit doesn't show a change
+	// that didn't happen. The bridge keeps running, as the next event may
+	// succeed, e.g. after reconnecting.
+	failed := func(ID int, attrs []slog.Attr, err error) {
+		attrs = append(attrs, slog.Any("error", err))
+		slog.LogAttrs(context.TODO(), slog.LevelError, "failed to send event", attrs...)
+
+		syncMu.Lock()
+		defer syncMu.Unlock()
+
+		if cellValue, ok := known[ID]; ok {
+			syncCellValue(home, apiConfig, cellValue)
+		}
+	}
+
+	// turn sends explicit on/off values, so that a stale state in HomeKit
+	// can't make a toggle do the opposite of what was asked.
+	turn := func(callback string, ID int, on bool) {
+		attrs := []slog.Attr{
+			slog.Int("object_id", ID),
+			slog.Bool("on", on),
+			slog.String("callback", callback),
+		}
+
+		device, ok := devicesByID[ID]
+		if !ok {
+			slog.LogAttrs(context.TODO(), slog.LevelError, "no such object", attrs...)
+			return
+		}
+
+		send := devices.TurnOff
+		if on {
+			send = devices.TurnOn
+		}
+
+		err := send(ctx, fhomeClient, device, experimental)
+		if err != nil {
+			failed(ID, attrs, err)
+		} else {
+			slog.LogAttrs(context.TODO(), slog.LevelInfo, "sent event", attrs...)
+		}
+	}
+
 	homekitClient := &homekit.Client{
-		PIN:  pin,
-		Name: name,
+		PIN:          pin,
+		Name:         name,
+		Experimental: experimental,
 		OnLightbulbUpdate: func(ID int, on bool) {
-			value := api.ValueToggle
+			turn("OnLightbulbUpdate", ID, on)
+		},
+		OnLEDUpdate: func(ID int, brightness int) {
+			value := api.MapLighting(brightness)
 			attrs := []slog.Attr{
 				slog.Int("object_id", ID),
 				slog.String("value", value),
-				slog.String("callback", "OnLightbulbUpdate"),
+				slog.String("callback", "OnLEDUpdate"),
 			}
 
 			err := fhomeClient.SendEvent(ctx, ID, value)
 			if err != nil {
-				attrs = append(attrs, slog.Any("error", err))
-				slog.LogAttrs(context.TODO(), slog.LevelError, "failed to send event", attrs...)
-				os.Exit(1)
+				failed(ID, attrs, err)
 			} else {
 				slog.LogAttrs(context.TODO(), slog.LevelInfo, "sent event", attrs...)
 			}
 		},
-		OnLEDUpdate: func(ID int, brightness int) {
-			value := api.MapLighting(brightness)
+		OnColorUpdate: func(ID int, color api.Color) {
+			value, err := api.Encode(api.RGB, color)
+			if err != nil {
+				slog.Error("failed to encode color", slog.Any("error", err), slog.Int("object_id", ID))
+				return
+			}
+
 			attrs := []slog.Attr{
 				slog.Int("object_id", ID),
 				slog.String("value", value),
-				slog.String("callback", "OnLEDUpdate"),
+				slog.String("callback", "OnColorUpdate"),
 			}
 
-			err := fhomeClient.SendEvent(ctx, ID, value)
+			err = fhomeClient.SendEvent(ctx, ID, value)
 			if err != nil {
-				attrs = append(attrs, slog.Any("error", err))
-				slog.LogAttrs(context.TODO(), slog.LevelError, "failed to send event", attrs...)
-				os.Exit(1)
+				failed(ID, attrs, err)
 			} else {
 				slog.LogAttrs(context.TODO(), slog.LevelInfo, "sent event", attrs...)
 			}
 		},
 		OnGarageDoorUpdate: func(ID int) {
-			value := api.ValueToggle
+			gate, ok := devicesByID[ID].(*devices.Gate)
+			if !ok {
+				slog.Error("object is not a gate", slog.Int("object_id", ID))
+				return
+			}
+			value := gate.Open()
+
 			attrs := []slog.Attr{
 				slog.Int("object_id", ID),
 				slog.String("value", value),
@@ -158,121 +244,281 @@ func homekitSyncer(ctx context.Context, fhomeClient *api.Client, apiConfig *api.
 
 			err := fhomeClient.SendEvent(ctx, ID, value)
 			if err != nil {
-				attrs = append(attrs, slog.Any("error", err))
-				slog.LogAttrs(context.TODO(), slog.LevelError, "failed to send event", attrs...)
-				os.Exit(1)
+				failed(ID, attrs, err)
+			} else {
+				slog.LogAttrs(context.TODO(), slog.LevelInfo, "sent event", attrs...)
+			}
+		},
+		OnBlindUpdate: func(ID int, position int) {
+			blind, ok := devicesByID[ID].(*devices.Blind)
+			if !ok {
+				slog.Error("object is not a blind", slog.Int("object_id", ID))
+				return
+			}
+			value := blind.SetPosition(position)
+
+			attrs := []slog.Attr{
+				slog.Int("object_id", ID),
+				slog.String("value", value),
+				slog.String("callback", "OnBlindUpdate"),
+			}
+
+			err := fhomeClient.SendEvent(ctx, ID, value)
+			if err != nil {
+				failed(ID, attrs, err)
 			} else {
 				slog.LogAttrs(context.TODO(), slog.LevelInfo, "sent event", attrs...)
 			}
 		},
 		OnThermostatUpdate: func(ID int, temperature float64) {
-			value := api.EncodeTemperature(temperature)
+			thermostat, ok := devicesByID[ID].(*devices.Thermostat)
+			if !ok {
+				slog.Error("object is not a thermostat", slog.Int("object_id", ID))
+				return
+			}
+			adjusted, value, err := thermostat.SetTarget(temperature)
+			if err != nil {
+				slog.Error("failed to get temperature range", slog.Any("error", err), slog.Int("object_id", ID))
+				return
+			}
+			if adjusted != temperature {
+				slog.Warn("temperature adjusted to the range of the object", slog.Int("object_id", ID), slog.Float64("requested", temperature), slog.Float64("adjusted", adjusted))
+			}
+
 			attrs := []slog.Attr{
 				slog.Int("object_id", ID),
 				slog.String("value", value),
 				slog.String("callback", "OnThermostatUpdate"),
 			}
 
-			err := fhomeClient.SendEvent(ctx, ID, value)
+			err = fhomeClient.SendEvent(ctx, ID, value)
 			if err != nil {
-				attrs = append(attrs, slog.Any("error", err))
-				slog.LogAttrs(context.TODO(), slog.LevelError, "failed to send event", attrs...)
-				os.Exit(1)
+				failed(ID, attrs, err)
 			} else {
 				slog.LogAttrs(context.TODO(), slog.LevelInfo, "sent event", attrs...)
 			}
 		},
 	}
 
-	home, err := homekitClient.SetUp(apiConfig)
+	var err error
+	home, err = homekitClient.SetUp(apiConfig)
 	if err != nil {
 		slog.Error("failed to set up homekit", slog.Any("error", err))
 		return err
 	}
 
+	// Start from the live state, so that HomeKit doesn't show stale values
+	// until the cells change.
+	for _, cell := range apiConfig.Cells() {
+		if cell.Value == "" {
+			continue
+		}
+
+		cellValue := api.CellValue{
+			ID:          strconv.Itoa(cell.ID),
+			DisplayType: api.DisplayType(cell.DisplayType),
+			Value:       cell.Value,
+			ValueStr:    cell.ValueStr,
+		}
+		update(cellValue)
+	}
+
+	home.Start(ctx)
+
 	// F&Home -> HomeKit
 	//
 	// In this loop, we listen to events from F&Home and send updates to HomeKit
 	// to keep the state in sync.
-	for {
-		msg, err := fhomeClient.ReadMessage(ctx, api.ActionStatusTouchesChanged, "")
-		if err != nil {
-			slog.Error("failed to read message", slog.Any("error", err))
-			return err
+	for change := range fhomeClient.Subscribe(ctx, api.CellFilter{}) {
+		for _, cellValue := range change.Values {
+			update(cellValue)
 		}
+	}
 
-		var resp api.StatusTouchesChangedResponse
+	if err := fhomeClient.Err(); err != nil {
+		slog.Error("session ended", slog.Any("error", err))
+		return err
+	}
 
-		err = json.Unmarshal(msg.Raw, &resp)
-		if err != nil {
-			slog.Error("failed to unmarshal message", slog.Any("error", err))
-			return err
-		}
+	return nil
+}
 
-		if len(resp.Response.CellValues) == 0 {
-			continue
-		}
+// syncCellValue updates the HomeKit accessory corresponding to cellValue.
+func syncCellValue(home *homekit.Home, apiConfig *api.Config, cellValue api.CellValue) {
+	cellID, err := cellValue.ParseID()
+	if err != nil {
+		slog.Error("failed to parse cell ID", slog.Any("error", err))
+		return
+	}
 
-		cellValue := resp.Response.CellValues[0]
-		err = highlevel.PrintCellData(&cellValue, apiConfig)
-		if err != nil {
-			slog.Error("failed to print cell data", slog.Any("error", err))
-			return err
-		}
+	err = highlevel.PrintCellData(&cellValue, apiConfig)
+	if err != nil {
+		// The cell is not placed in any panel, so it has no accessory.
+		slog.Debug("failed to print cell data", slog.Any("error", err))
+		return
+	}
 
-		// handle lightbulb
-		{
-			accessory := home.Lightbulbs[cellValue.IntID()]
-			if accessory != nil {
-				switch cellValue.ValueStr {
-				case "100%":
-					accessory.Lightbulb.On.SetValue(true)
-				case "0%":
-					accessory.Lightbulb.On.SetValue(false)
+	// handle lightbulb
+	{
+		accessory := home.Lightbulbs[cellID]
+		if accessory != nil {
+			if cellValue.DisplayType == api.Bit {
+				if on, err := api.Decode(cellValue); err == nil {
+					accessory.Lightbulb.On.SetValue(on.(bool))
 				}
 			}
+
+			switch cellValue.ValueStr {
+			case "100%":
+				accessory.Lightbulb.On.SetValue(true)
+			case "0%":
+				accessory.Lightbulb.On.SetValue(false)
+			}
 		}
+	}
 
-		// handle LEDs
-		{
-			accessory := home.ColoredLightbulbs[cellValue.IntID()]
-			if accessory != nil {
-				newValue, err := api.RemapLighting(cellValue.Value)
-				if err != nil {
-					slog.Error("failed to remap lightning value",
-						slog.Any("error", err),
-						slog.String("value", cellValue.Value),
-						slog.Int("object_id", cellValue.IntID()),
-					)
-				}
+	// handle LEDs
+	{
+		accessory := home.DimmableLightbulbs[cellID]
+		if accessory != nil {
+			newValue, err := api.RemapLighting(cellValue.Value)
+			if err != nil {
+				slog.Error("failed to remap lightning value",
+					slog.Any("error", err),
+					slog.String("value", cellValue.Value),
+					slog.Int("object_id", cellID),
+				)
+			}
+
+			accessory.Lightbulb.On.SetValue(newValue > 0)
+			err = accessory.Brightness.SetValue(newValue)
+			if err != nil {
+				slog.Error("failed to set brightness",
+					slog.Any("error", err),
+					slog.Int("value", newValue),
+					slog.Int("object_id", cellID),
+				)
+			}
+		}
+	}
+
+	// handle RGB lights
+	{
+		accessory := home.RGBLightbulbs[cellID]
+		if accessory != nil {
+			decoded, err := api.Decode(cellValue)
+			color, ok := decoded.(api.Color)
+			if err != nil || !ok {
+				slog.Error("failed to decode color",
+					slog.Any("error", err),
+					slog.String("value", cellValue.Value),
+					slog.Int("object_id", cellID),
+				)
+				return
+			}
 
-				accessory.Lightbulb.On.SetValue(newValue > 0)
-				err = accessory.Lightbulb.Brightness.SetValue(newValue)
+			h, s, v := color.HSV()
+			accessory.Lightbulb.On.SetValue(v > 0)
+			if v > 0 {
+				// Keep the last color in HomeKit when the light is turned off.
+				accessory.Lightbulb.Hue.SetValue(h)
+				accessory.Lightbulb.Saturation.SetValue(s)
+				err = accessory.Lightbulb.Brightness.SetValue(int(math.Round(v)))
 				if err != nil {
 					slog.Error("failed to set brightness",
 						slog.Any("error", err),
-						slog.Int("value", newValue),
-						slog.Int("object_id", cellValue.IntID()),
+						slog.Float64("value", v),
+						slog.Int("object_id", cellID),
 					)
 				}
 			}
 		}
+	}
 
-		// handle thermostats
-		{
-			accessory := home.Thermostats[cellValue.IntID()]
-			if accessory != nil {
-				newValue, err := api.DecodeTemperatureValue(cellValue.Value)
-				if err != nil {
-					slog.Error("failed to remap temperature",
-						slog.Any("error", err),
-						slog.String("value", cellValue.Value),
-						slog.Int("object_id", cellValue.IntID()),
-					)
-				}
+	// handle temperature sensors
+	{
+		accessory := home.TemperatureSensors[cellID]
+		if accessory != nil {
+			decoded, err := api.Decode(cellValue)
+			temp, ok := decoded.(api.Celsius)
+			if err != nil || !ok {
+				slog.Error("failed to decode temperature",
+					slog.Any("error", err),
+					slog.String("value", cellValue.Value),
+					slog.Int("object_id", cellID),
+				)
+				return
+			}
+
+			accessory.TempSensor.CurrentTemperature.SetValue(float64(temp))
+		}
+	}
+
+	// handle gates
+	{
+		accessory := home.GarageDoors[cellID]
+		if accessory != nil {
+			decoded, _ := api.Decode(cellValue)
 
-				accessory.Thermostat.TargetTemperature.SetValue(newValue)
+			var open bool
+			switch v := decoded.(type) {
+			case bool:
+				open = v
+			case api.Percent:
+				open = v > 0
+			case uint8:
+				open = v != 0
+			default:
+				slog.Error("failed to decode gate state",
+					slog.String("value", cellValue.Value),
+					slog.Int("object_id", cellID),
+				)
+				return
 			}
+
+			current, target := characteristic.CurrentDoorStateClosed, characteristic.TargetDoorStateClosed
+			if open {
+				current, target = characteristic.CurrentDoorStateOpen, characteristic.TargetDoorStateOpen
+			}
+			accessory.GarageDoorOpener.CurrentDoorState.SetValue(current)
+			accessory.GarageDoorOpener.TargetDoorState.SetValue(target)
+		}
+	}
+
+	// handle blinds
+	{
+		accessory := home.Blinds[cellID]
+		if accessory != nil {
+			position, err := api.RemapLighting(cellValue.Value)
+			if err != nil {
+				slog.Error("failed to remap blind position",
+					slog.Any("error", err),
+					slog.String("value", cellValue.Value),
+					slog.Int("object_id", cellID),
+				)
+				return
+			}
+
+			accessory.WindowCovering.CurrentPosition.SetValue(position)
+			accessory.WindowCovering.TargetPosition.SetValue(position)
+			accessory.WindowCovering.PositionState.SetValue(characteristic.PositionStateStopped)
+		}
+	}
+
+	// handle thermostats
+	{
+		accessory := home.Thermostats[cellID]
+		if accessory != nil {
+			newValue, err := api.DecodeTemperatureValue(cellValue.Value)
+			if err != nil {
+				slog.Error("failed to remap temperature",
+					slog.Any("error", err),
+					slog.String("value", cellValue.Value),
+					slog.Int("object_id", cellID),
+				)
+			}
+
+			accessory.Thermostat.TargetTemperature.SetValue(newValue)
 		}
 	}
 }
@@ -39,6 +39,8 @@ func main() {
 				Usage: "port to listen on",
 				Value: 9001,
 			},
+			internal.ResourceFlag,
+			internal.UnassignedFlag,
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			var level slog.Level
@@ -70,7 +72,7 @@ func main() {
 }
 
 func run(ctx context.Context, cmd *cli.Command) error {
-	config := internal.Load()
+	config := internal.LoadWithFlags(cmd)
 	port := int(cmd.Int("port"))
 
 	apiClient, err := highlevel.Connect(ctx, config, nil)
@@ -78,7 +80,7 @@ func run(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("connect to fhome: %v", err)
 	}
 
-	apiConfig, err := highlevel.GetConfigs(ctx, apiClient)
+	apiConfig, err := highlevel.GetConfigs(ctx, apiClient, config.MergeOptions()...)
 	if err != nil {
 		return fmt.Errorf("get configs: %v", err)
 	}
@@ -88,5 +90,5 @@ func run(ctx context.Context, cmd *cli.Command) error {
 		slog.Int("cells", len(apiConfig.Cells())),
 	)
 
-	return webserver.Run(ctx, apiClient, apiConfig, config.Email, port)
+	return webserver.Run(ctx, apiClient, apiConfig, config.Email, port, config.Experimental)
 }
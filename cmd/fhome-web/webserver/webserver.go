@@ -4,14 +4,18 @@ package webserver
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/devices"
 )
 
 //go:embed assets/*
@@ -22,16 +26,33 @@ var templates embed.FS
 
 var tmpl = template.Must(template.ParseFS(templates, "templates/*"))
 
-func Run(ctx context.Context, client *api.Client, homeConfig *api.Config, email string, port int) error {
+// Run serves the endpoints on port until ctx is done. Unless experimental is
+// set, values that are not confirmed to work with real devices are rejected,
+// see [devices.Unconfirmed].
+func Run(ctx context.Context, client *api.Client, homeConfig *api.Config, email string, port int, experimental bool) error {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /index", func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("got request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
 
+		// Maps cell ID to the range of temperatures accepted by the cell.
+		ranges := make(map[int]*api.TemperatureRange)
+		for _, device := range devices.FromConfig(homeConfig) {
+			if thermostat, ok := device.(*devices.Thermostat); ok {
+				r, err := thermostat.Range()
+				if err != nil {
+					slog.Error("failed to get temperature range", slog.Any("error", err))
+					continue
+				}
+				ranges[device.Cell().ID] = &r
+			}
+		}
+
 		data := map[string]any{
 			"Email":  email,
 			"Panels": homeConfig.Panels,
 			"Cells":  homeConfig.Cells(),
+			"Ranges": ranges,
 		}
 
 		tmpl.ExecuteTemplate(w, "index.html.tmpl", data)
@@ -51,6 +72,121 @@ func Run(ctx context.Context, client *api.Client, homeConfig *api.Config, email
 		}
 	})
 
+	mux.HandleFunc("POST /objects/{id}/temperature", func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("got request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid object id: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		temperature, err := strconv.ParseFloat(r.FormValue("value"), 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid value: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		cell, err := homeConfig.GetCellByID(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("no object with id %d", id), http.StatusNotFound)
+			return
+		}
+
+		thermostat, ok := devices.Classify(*cell).(*devices.Thermostat)
+		if !ok {
+			http.Error(w, fmt.Sprintf("object with id %d is not a thermostat", id), http.StatusNotFound)
+			return
+		}
+
+		adjusted, value, err := thermostat.SetTarget(temperature)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get temperature range: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if adjusted != temperature {
+			slog.Warn("temperature adjusted to the range of the object", slog.Float64("requested", temperature), slog.Float64("adjusted", adjusted))
+		}
+
+		err = client.SendEvent(ctx, id, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to send event: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(w, "%.1f", adjusted)
+	})
+
+	turn := func(on bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			slog.Info("got request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+
+			id, err := strconv.Atoi(r.PathValue("id"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid object id: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			cell, err := homeConfig.GetCellByID(id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("no object with id %d", id), http.StatusNotFound)
+				return
+			}
+
+			device := devices.Classify(*cell)
+			value, err := devices.OnOffValue(ctx, client, device, on, experimental)
+			if errors.Is(err, devices.ErrUnsupported) {
+				http.Error(w, fmt.Sprintf("object with id %d can't be turned on or off", id), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to get value: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if value == "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if !experimental {
+				if err := devices.CheckConfirmed(device, value); err != nil {
+					http.Error(w, fmt.Sprintf("%v, set FHOME_EXPERIMENTAL=true to send it anyway", err), http.StatusBadRequest)
+					return
+				}
+			}
+
+			err = client.SendEvent(ctx, id, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to send event: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	mux.HandleFunc("POST /objects/{id}/on", turn(true))
+	mux.HandleFunc("POST /objects/{id}/off", turn(false))
+
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		health := struct {
+			LastMessageAt time.Time `json:"last_message_at"`
+			RTTMillis     float64   `json:"rtt_ms"`
+			Error         string    `json:"error,omitempty"`
+		}{
+			LastMessageAt: client.LastMessageAt(),
+			RTTMillis:     float64(client.RTT()) / float64(time.Millisecond),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := client.Err(); err != nil {
+			health.Error = err.Error()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_ = json.NewEncoder(w).Encode(health)
+	})
+
 	mux.Handle("GET /public", http.StripPrefix("/public/", http.FileServer(http.FS(assets))))
 	addr := fmt.Sprint("0.0.0.0:", port)
 	httpServer := http.Server{Addr: addr, Handler: mux}
@@ -4,14 +4,44 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/highlevel"
 )
 
+// cache is the offline copy of the configuration and the last known state of
+// a resource.
+//
+// It's invalidated when a response from the resource carries a project
+// version other than the cached one, that is, when the installation has been
+// reconfigured.
+type cache struct {
+	// Account and resource that the cache was created for. The resource is
+	// empty for the default one.
+	Email    string
+	Resource string
+
+	ProjectVersion string
+	UpdatedAt      time.Time
+
+	UserConfig   *api.UserConfig
+	SystemConfig *api.TouchesResponse
+	// Merged config, including cells that are not placed in any panel.
+	Config *api.Config
+	// Last "statustouches" response, updated with values of cells reported
+	// later.
+	Status *api.StatusTouchesChangedResponse
+	// When Status was last updated.
+	StatusUpdatedAt time.Time
+}
+
 // cacheDir returns the path to the cache directory.
 func cacheDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -28,20 +58,21 @@ func cacheDir() (string, error) {
 	return cacheDir, nil
 }
 
-// userConfigCachePath returns the path to the user config cache file.
-func userConfigCachePath() (string, error) {
+// cachePath returns the path to the cache file.
+func cachePath() (string, error) {
 	dir, err := cacheDir()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(dir, "user_config.json"), nil
+	return filepath.Join(dir, "cache.json"), nil
 }
 
-// readUserConfigFromCache reads the user config from the cache file.
-// If the cache file doesn't exist or is invalid, it returns nil and an error.
-func readUserConfigFromCache() (*api.UserConfig, error) {
-	path, err := userConfigCachePath()
+// readCache reads the cache created for the account and resource in config.
+// If the cache file doesn't exist, is invalid or was created for another
+// resource, it returns nil and an error.
+func readCache(config *highlevel.Config) (*cache, error) {
+	path, err := cachePath()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cache path: %w", err)
 	}
@@ -51,25 +82,33 @@ func readUserConfigFromCache() (*api.UserConfig, error) {
 		return nil, fmt.Errorf("failed to read cache file: %w", err)
 	}
 
-	var userConfig api.UserConfig
-	err = json.Unmarshal(data, &userConfig)
+	var c cache
+	err = json.Unmarshal(data, &c)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal cache file: %w", err)
 	}
 
-	return &userConfig, nil
+	if c.Config == nil || c.UserConfig == nil || c.SystemConfig == nil || c.Status == nil {
+		return nil, fmt.Errorf("cache file is incomplete")
+	}
+
+	if c.Email != config.Email || c.Resource != config.Resource {
+		return nil, fmt.Errorf("cache file was created for another resource")
+	}
+
+	return &c, nil
 }
 
-// writeUserConfigToCache writes the user config to the cache file.
-func writeUserConfigToCache(userConfig *api.UserConfig) error {
-	path, err := userConfigCachePath()
+// writeCache writes c to the cache file.
+func writeCache(c *cache) error {
+	path, err := cachePath()
 	if err != nil {
 		return err
 	}
 
-	data, err := json.Marshal(userConfig)
+	data, err := json.Marshal(c)
 	if err != nil {
-		return fmt.Errorf("failed to marshal user config: %w", err)
+		return fmt.Errorf("failed to marshal cache: %w", err)
 	}
 
 	err = os.WriteFile(path, data, 0o644)
@@ -80,45 +119,232 @@ func writeUserConfigToCache(userConfig *api.UserConfig) error {
 	return nil
 }
 
-// updateCache updates the cache in a non-blocking way.
-// It returns immediately and updates the cache in a goroutine.
-func updateCache(ctx context.Context, createClient func() (*api.Client, error)) {
-	client, err := createClient()
+// clearCache removes the cache file. It's not an error if it doesn't exist.
+func clearCache() error {
+	path, err := cachePath()
 	if err != nil {
-		slog.Error("failed to create API client: ", slog.Any("error", err))
-		return
+		return err
 	}
 
-	userConfig, err := client.GetUserConfig(ctx)
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cache file: %w", err)
+	}
+
+	return nil
+}
+
+// refreshCache fetches the configuration and the state of the resource and
+// writes them to the cache.
+func refreshCache(ctx context.Context, client *api.Client, config *highlevel.Config) (*cache, error) {
+	// The project may change between the requests, so retry until both
+	// responses agree on its version.
+	for attempt := 1; ; attempt++ {
+		userConfig, err := client.GetUserConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user config: %w", err)
+		}
+
+		sysConfig, err := client.GetSystemConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get system config: %w", err)
+		}
+
+		status, err := fetchStatus(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+
+		version := userConfig.Server.ProjectVersion
+		if sysConfig.Response.ProjectVersion != version || status.Response.ProjectVersion != version {
+			if attempt < 3 {
+				slog.Debug("project version changed while refreshing cache", slog.Int("attempt", attempt))
+				continue
+			}
+			return nil, fmt.Errorf("project version keeps changing: %s, then %s, then %s",
+				version, sysConfig.Response.ProjectVersion, status.Response.ProjectVersion,
+			)
+		}
+
+		apiConfig, err := api.MergeConfigs(userConfig, sysConfig, api.IncludeUnassigned())
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge configs: %w", err)
+		}
+
+		now := time.Now()
+		c := &cache{
+			Email:           config.Email,
+			Resource:        config.Resource,
+			ProjectVersion:  version,
+			UpdatedAt:       now,
+			UserConfig:      userConfig,
+			SystemConfig:    sysConfig,
+			Config:          apiConfig,
+			Status:          status,
+			StatusUpdatedAt: now,
+		}
+
+		err = writeCache(c)
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Debug("refreshed cache", slog.String("project_version", version))
+		return c, nil
+	}
+}
+
+// fetchStatus returns the "statustouches" response with the live state of all
+// cells. The one sent while connecting is used if it wasn't already, see
+// [api.Client.TakeSessionStatus].
+func fetchStatus(ctx context.Context, client *api.Client) (*api.StatusTouchesChangedResponse, error) {
+	if status := client.TakeSessionStatus(); status != nil {
+		return status, nil
+	}
+
+	msg, err := client.SendAction(ctx, api.ActionStatusTouches)
 	if err != nil {
-		slog.Error("failed to get user config for cache update", slog.Any("error", err))
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	var status api.StatusTouchesChangedResponse
+	err = json.Unmarshal(msg.Raw, &status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal status: %w", err)
+	}
+
+	return &status, nil
+}
+
+// loadCache returns the cache, refreshing it with client if it's missing or if
+// the project version reported by the resource differs from the cached one.
+//
+// The version is checked with a "statustouches" request, whose response also
+// replaces the cached state. So a command that uses the cache takes a single
+// round trip before it sends anything, and the state is never older than the
+// last command.
+func loadCache(ctx context.Context, client *api.Client, config *highlevel.Config) (*cache, error) {
+	c, err := readCache(config)
+	if err != nil {
+		slog.Debug("cache miss or error, refreshing", slog.Any("error", err))
+		return refreshCache(ctx, client, config)
+	}
+
+	status, err := fetchStatus(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	version := status.Response.ProjectVersion
+	if version != c.ProjectVersion {
+		slog.Info("project version changed, refreshing cache",
+			slog.String("cached", c.ProjectVersion),
+			slog.String("current", version),
+		)
+		return refreshCache(ctx, client, config)
+	}
+
+	c.Status = status
+	c.StatusUpdatedAt = time.Now()
+	err = writeCache(c)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("cache hit", slog.String("project_version", c.ProjectVersion))
+	return c, nil
+}
+
+// recordValues updates the cached state with values reported by the resource,
+// if the cache exists. Failing to do so is not fatal, so it's only logged.
+func recordValues(config *highlevel.Config, values ...api.CellValue) {
+	c, err := readCache(config)
+	if err != nil {
+		slog.Debug("not recording values, no cache", slog.Any("error", err))
 		return
 	}
 
-	err = writeUserConfigToCache(userConfig)
+	cached := c.Status.Response.CellValues
+	for _, cv := range values {
+		i := slices.IndexFunc(cached, func(old api.CellValue) bool { return old.ID == cv.ID })
+		if i < 0 {
+			cached = append(cached, cv)
+			continue
+		}
+		cached[i] = cv
+	}
+	c.Status.Response.CellValues = cached
+	c.StatusUpdatedAt = time.Now()
+
+	err = writeCache(c)
+	if err != nil {
+		slog.Error("failed to record values in cache", slog.Any("error", err))
+	}
+}
+
+// cachedState returns the last known state of the cell with id, if the cache
+// has it.
+func cachedState(config *highlevel.Config, id int) (api.CellState, bool) {
+	c, err := readCache(config)
+	if err != nil {
+		return api.CellState{}, false
+	}
+
+	status, err := c.status()
 	if err != nil {
-		slog.Error("failed to write user config to cache", slog.Any("error", err))
+		return api.CellState{}, false
+	}
+
+	state, ok := status.Cells[id]
+	return state, ok
+}
+
+// checkCacheVersion removes the cache if it's for a project version other than
+// version, as seen in a response from the resource.
+func checkCacheVersion(config *highlevel.Config, version string) {
+	c, err := readCache(config)
+	if err != nil || c.ProjectVersion == version {
 		return
 	}
 
-	slog.Debug("updated user config cache")
+	slog.Info("project version changed, clearing cache",
+		slog.String("cached", c.ProjectVersion),
+		slog.String("current", version),
+	)
+
+	err = clearCache()
+	if err != nil {
+		slog.Error("failed to clear cache", slog.Any("error", err))
+	}
+}
+
+// mergedConfig returns the cached merged config, honoring the merge options in
+// config.
+func (c *cache) mergedConfig(config *highlevel.Config) *api.Config {
+	apiConfig := *c.Config
+	if !config.IncludeUnassigned {
+		apiConfig.Panels = slices.DeleteFunc(slices.Clone(apiConfig.Panels), func(panel api.Panel) bool {
+			return panel.ID == api.UnassignedPanelID
+		})
+	}
+
+	return &apiConfig
+}
+
+// status returns the last known state of cells.
+func (c *cache) status() (*api.Status, error) {
+	return api.ParseStatus(c.Status)
 }
 
 // getUserConfig returns the user config, either from cache or from the server.
 //
-// If the cache exists and is valid, it returns the cached config and updates the cache in the background.
-//
-// If the cache doesn't exist or is invalid, it calls the provided userConfigGetter to fetch the config
-// and updates the cache.
-//
-// The userConfigGetter is a function that retrieves the user configuration when called.
-func getUserConfig(ctx context.Context, createClient func() (*api.Client, error)) (*api.UserConfig, error) {
+// If the cache doesn't exist or is invalid, it creates a client with
+// createClient and refreshes the cache.
+func getUserConfig(ctx context.Context, config *highlevel.Config, createClient func() (*api.Client, error)) (*api.UserConfig, error) {
 	slog.Debug("getting user config from cache")
-	userConfig, err := readUserConfigFromCache()
+	c, err := readCache(config)
 	if err == nil {
-		slog.Debug("cache hit! Starting background update and returning")
-		go updateCache(ctx, createClient)
-		return userConfig, nil
+		return c.UserConfig, nil
 	}
 
 	slog.Debug("cache miss or error, fetching new user config", slog.Any("error", err))
@@ -126,17 +352,11 @@ func getUserConfig(ctx context.Context, createClient func() (*api.Client, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new client: %w", err)
 	}
-	userConfig, err = client.GetUserConfig(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user config: %w", err)
-	}
 
-	// Write to cache
-	err = writeUserConfigToCache(userConfig)
+	c, err = refreshCache(ctx, client, config)
 	if err != nil {
-		slog.Error("failed to write user config to cache", slog.Any("error", err))
-		// Continue even if cache write fails
+		return nil, err
 	}
 
-	return userConfig, nil
+	return c.UserConfig, nil
 }
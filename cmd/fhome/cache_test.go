@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+	"github.com/bartekpacia/fhome/devices"
+	"github.com/bartekpacia/fhome/highlevel"
+)
+
+var testHouse = fhometest.House{
+	Panels: []fhometest.Panel{
+		{ID: "1", Name: "Ground floor", Cells: []fhometest.Cell{
+			{ID: 300, Name: "Kitchen", Icon: api.IconLighting, DisplayType: api.Percentage, Value: "0x6000"},
+			{ID: 301, Name: "Lamp", Icon: api.IconLighting, DisplayType: api.Bit, Value: "0x0000"},
+		}},
+	},
+}
+
+// connect sets up an empty home directory, so that the cache of the user
+// isn't touched, and returns a client connected to srv.
+func connect(t *testing.T, srv *fhometest.Server) (*api.Client, *highlevel.Config) {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+
+	config := &highlevel.Config{
+		Email:            fhometest.Email,
+		Password:         fhometest.Password,
+		ResourcePassword: fhometest.ResourcePassword,
+		URL:              srv.URL,
+	}
+
+	return srv.Connect(t), config
+}
+
+func TestLoadCache(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client, config := connect(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := loadCache(ctx, client, config)
+	if err != nil {
+		t.Fatalf("loadCache() error = %v", err)
+	}
+	if c.ProjectVersion != "1" {
+		t.Errorf("got project version %q, want %q", c.ProjectVersion, "1")
+	}
+	if _, err := c.Config.GetCellByID(301); err != nil {
+		t.Errorf("cell 301 not cached: %v", err)
+	}
+	// The state fetched while connecting is reused.
+	if got := srv.Requests(api.ActionStatusTouches); got != 1 {
+		t.Errorf("server got %d %s requests, want 1", got, api.ActionStatusTouches)
+	}
+
+	again, err := loadCache(ctx, client, config)
+	if err != nil {
+		t.Fatalf("loadCache() error = %v", err)
+	}
+	if !again.UpdatedAt.Equal(c.UpdatedAt) {
+		t.Errorf("cache was refreshed although the project version didn't change")
+	}
+
+	// The live state replaces the cached one on each load.
+	srv.SetValue(300, "0x6032")
+	again, err = loadCache(ctx, client, config)
+	if err != nil {
+		t.Fatalf("loadCache() error = %v", err)
+	}
+	if got := cachedValue(t, again, 300); got != "0x6032" {
+		t.Errorf("cached value of cell 300 = %s after it changed, want 0x6032", got)
+	}
+
+	srv.SetProjectVersion("2")
+
+	refreshed, err := loadCache(ctx, client, config)
+	if err != nil {
+		t.Fatalf("loadCache() error = %v", err)
+	}
+	if refreshed.ProjectVersion != "2" {
+		t.Errorf("got project version %q after the project changed, want %q", refreshed.ProjectVersion, "2")
+	}
+
+	stored, err := readCache(config)
+	if err != nil {
+		t.Fatalf("readCache() error = %v", err)
+	}
+	if stored.ProjectVersion != "2" {
+		t.Errorf("stored project version %q, want %q", stored.ProjectVersion, "2")
+	}
+}
+
+func TestReadCache_OtherResource(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client, config := connect(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := refreshCache(ctx, client, config); err != nil {
+		t.Fatalf("refreshCache() error = %v", err)
+	}
+
+	other := *config
+	other.Resource = "Summer house"
+	if _, err := readCache(&other); err == nil {
+		t.Errorf("readCache() for another resource succeeded, want error")
+	}
+}
+
+func TestResolveObject(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client, config := connect(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cell, err := resolveObject(ctx, client, config, "kitchen", devices.KindDimmer)
+	if err != nil {
+		t.Fatalf("resolveObject() error = %v", err)
+	}
+	if cell.ID != 300 {
+		t.Errorf("resolved cell %d, want 300", cell.ID)
+	}
+
+	cell, err = resolveObject(ctx, client, config, "999", devices.KindDimmer)
+	if err != nil {
+		t.Fatalf("resolveObject() error = %v", err)
+	}
+	if cell.ID != 999 {
+		t.Errorf("resolved cell %d, want 999", cell.ID)
+	}
+}
+
+func TestRecordValues(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+	client, config := connect(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := refreshCache(ctx, client, config); err != nil {
+		t.Fatalf("refreshCache() error = %v", err)
+	}
+
+	recordValues(config, api.CellValue{ID: "301", DisplayType: api.Bit, Value: "0x0001"})
+
+	c, err := readCache(config)
+	if err != nil {
+		t.Fatalf("readCache() error = %v", err)
+	}
+	if got := cachedValue(t, c, 301); got != "0x0001" {
+		t.Errorf("cached value of cell 301 = %s, want 0x0001", got)
+	}
+	if got := cachedValue(t, c, 300); got != "0x6000" {
+		t.Errorf("cached value of cell 300 = %s, want it unchanged", got)
+	}
+}
+
+// cachedValue returns the cached value of the cell with id.
+func cachedValue(t *testing.T, c *cache, id int) string {
+	t.Helper()
+
+	status, err := c.status()
+	if err != nil {
+		t.Fatalf("status() error = %v", err)
+	}
+
+	return status.Cells[id].Value
+}
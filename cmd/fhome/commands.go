@@ -1,50 +1,136 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/adrg/strutil"
 	"github.com/adrg/strutil/metrics"
 	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/devices"
 	"github.com/bartekpacia/fhome/highlevel"
 	"github.com/bartekpacia/fhome/internal"
 
 	"github.com/urfave/cli/v3"
 )
 
-// bestObjectMatch returns the cell with the highest similarity score to the given object and the score itself.
+// bestObjectMatch returns the cell of one of the given kinds with the highest similarity score to the given object and the score itself.
 //
 // If no objects match at all (i.e., bestScore is 0), then this method returns nil.
-func bestObjectMatch(object string, config *api.Config) (bestObject *api.Cell, bestScore float64) {
-	for _, cell := range config.Cells() {
-
-		if cell.DisplayType != string(api.Percentage) {
+func bestObjectMatch(object string, config *api.Config, kinds ...devices.Kind) (bestObject *api.Cell, bestScore float64) {
+	for _, device := range devices.FromConfig(config) {
+		if !slices.Contains(kinds, device.Kind()) {
 			continue
 		}
 
+		cell := device.Cell()
+
 		score := strutil.Similarity(object, cell.Name, metrics.NewSorensenDice())
 		if score > bestScore {
 			bestScore = score
-			bestObject = &cell
+			bestObject = cell
 		}
 	}
 
 	return bestObject, bestScore
 }
 
+// resolveObject returns the cell named by object, which is either an ID or a
+// name. Names are matched against cells of the given kinds.
+//
+// Cells are looked up in the cache, so that resolving a name doesn't need a
+// round trip to the resource. The cache is refreshed with client if it's
+// missing.
+func resolveObject(ctx context.Context, client *api.Client, config *highlevel.Config, object string, kinds ...devices.Kind) (*api.Cell, error) {
+	c, err := loadCache(ctx, client, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache: %v", err)
+	}
+
+	// The client doesn't fetch the system config on its own, so it needs to
+	// learn about read-only cells from the cache.
+	client.RecordPermissions(c.SystemConfig)
+
+	return c.resolve(config, object, kinds...)
+}
+
+// resolve is like [resolveObject], but doesn't check whether c is up to date.
+func (c *cache) resolve(config *highlevel.Config, object string, kinds ...devices.Kind) (*api.Cell, error) {
+	objectID, err := strconv.Atoi(object)
+	if err == nil {
+		cell, err := c.Config.GetCellByID(objectID)
+		if err != nil {
+			// The cell may still exist, e.g. if the cache is stale.
+			slog.Debug("object not found in cache", slog.Int("id", objectID))
+			return &api.Cell{ID: objectID}, nil
+		}
+
+		return cell, nil
+	}
+
+	slog.Info("looking for object", slog.String("name", object))
+
+	bestObject, bestScore := bestObjectMatch(object, c.mergedConfig(config), kinds...)
+	if bestObject == nil {
+		return nil, fmt.Errorf("no matching object found, confidence is %d%%", int(bestScore*100))
+	}
+
+	slog.Info("found best match",
+		slog.Int("confidence", int(bestScore*100)),
+		slog.Group("object", slog.String("name", bestObject.Name), slog.Int("id", bestObject.ID)),
+	)
+
+	return bestObject, nil
+}
+
+var accountCommand = cli.Command{
+	Name:  "account",
+	Usage: "Print information about the account in use",
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		config := internal.LoadWithFlags(cmd)
+
+		client, err := highlevel.Connect(ctx, config, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create api client: %v", err)
+		}
+
+		data, err := client.GetMyData(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get my data: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer w.Flush()
+		// Skip the fields that every response has.
+		envelope := []string{"action_name", "request_token", "status", "source"}
+		for _, key := range slices.Sorted(maps.Keys(data.Fields)) {
+			if slices.Contains(envelope, key) {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s\t%v\n", key, data.Fields[key])
+		}
+		return nil
+	},
+}
+
 var systemstatusCommand = cli.Command{
 	Name:  "systemstatus",
 	Usage: "Print basic system info from the resource",
 	Action: func(ctx context.Context, cmd *cli.Command) error {
-		config := internal.Load()
+		config := internal.LoadWithFlags(cmd)
 
 		client, err := highlevel.Connect(ctx, config, nil)
 		if err != nil {
@@ -100,7 +186,7 @@ var configCommand = cli.Command{
 					return fmt.Errorf("cannot use both --system and --user")
 				}
 
-				config := internal.Load()
+				config := internal.LoadWithFlags(cmd)
 
 				client, err := highlevel.Connect(ctx, config, nil)
 				if err != nil {
@@ -112,6 +198,7 @@ var configCommand = cli.Command{
 					return fmt.Errorf("failed to get sysConfig: %v", err)
 				}
 				log.Println("got system config")
+				checkCacheVersion(config, sysConfig.Response.ProjectVersion)
 
 				userConfig, err := client.GetUserConfig(ctx)
 				if err != nil {
@@ -119,7 +206,7 @@ var configCommand = cli.Command{
 				}
 				log.Println("got user config")
 
-				apiConfig, err := api.MergeConfigs(userConfig, sysConfig)
+				apiConfig, err := api.MergeConfigs(userConfig, sysConfig, config.MergeOptions()...)
 				if err != nil {
 					return fmt.Errorf("failed to merge configs: %v", err)
 				}
@@ -129,11 +216,11 @@ var configCommand = cli.Command{
 					w := tabwriter.NewWriter(os.Stdout, 8, 8, 0, ' ', 0)
 					defer w.Flush()
 
-					fmt.Fprintf(w, "id\tdt\tpreset\tstyle\tperm\tmin\tmax\tstep\tdesc\n")
+					fmt.Fprintf(w, "id\ttype\tdt\tpreset\tstyle\tperm\tmin\tmax\tstep\tdesc\n")
 
 					cells := sysConfig.Response.MobileDisplayProperties.Cells
 					for _, cell := range cells {
-						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", cell.ID, cell.DisplayType, cell.Preset, cell.Style, cell.Permission, cell.MinValue, cell.MaxValue, cell.Step, cell.Desc)
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", cell.ID, cell.TypeNumber, cell.DisplayType, cell.Preset, cell.Style, cell.Permission, cell.MinValue, cell.MaxValue, cell.Step, cell.Desc)
 					}
 				} else if cmd.Bool("user") {
 					panels := map[string]api.UserPanel{}
@@ -157,7 +244,7 @@ var configCommand = cli.Command{
 						fmt.Fprintf(w, "%3d\t%s\t%s\t%s\n", cell.ObjectID, cell.IconName(), cell.Name, p)
 					}
 				} else if cmd.Bool("merged") {
-					config, err := api.MergeConfigs(userConfig, sysConfig)
+					config, err := api.MergeConfigs(userConfig, sysConfig, config.MergeOptions()...)
 					if err != nil {
 						return fmt.Errorf("failed to merge configs: %v", err)
 					}
@@ -166,7 +253,7 @@ var configCommand = cli.Command{
 					for _, panel := range config.Panels {
 						log.Printf("panel id: %s, name: %s", panel.ID, panel.Name)
 						for _, cell := range panel.Cells {
-							log.Printf("\tid: %d, name: %s", cell.ID, cell.Name)
+							log.Printf("\tid: %d, name: %s, kind: %s", cell.ID, cell.Name, devices.Classify(cell).Kind())
 						}
 						log.Println()
 					}
@@ -175,17 +262,9 @@ var configCommand = cli.Command{
 					// To do that, we need to send the "statustouches" action and
 					// wait for its response.
 
-					msg, err := client.SendAction(ctx, api.ActionStatusTouches)
-					if err != nil {
-						return fmt.Errorf("failed to send action: %v", err)
-					}
-
-					var touchesResponse api.StatusTouchesChangedResponse
-
-					err = json.Unmarshal(msg.Raw, &touchesResponse)
+					status, err := client.GetStatus(ctx)
 					if err != nil {
-						slog.Error("failed to unmarshal message", slog.Any("error", err))
-						return err
+						return fmt.Errorf("failed to get status: %v", err)
 					}
 
 					cells := make([]struct {
@@ -202,25 +281,24 @@ var configCommand = cli.Command{
 							continue
 						}
 
-						var cellValue *api.CellValue
-						for _, cv := range touchesResponse.Response.CellValues {
-							if cv.ID == cell.ID {
-								cellValue = &cv
-								break
-							}
+						cellID, err := strconv.Atoi(cell.ID)
+						if err != nil {
+							slog.Error("failed to parse cell ID", slog.String("cell", cell.ID), slog.Any("error", err))
+							continue
 						}
-						if cellValue == nil {
+
+						state, ok := status.Cells[cellID]
+						if !ok {
 							slog.Error("failed to find corresponding cell value", slog.String("cell", cell.ID))
 							continue
 						}
 
-						slog.Info("remapping lighting value", slog.String("cell", cell.Desc), slog.String("value", cellValue.Value), slog.String("step", cell.Step))
-						val, err := api.RemapLighting(cellValue.Value)
-						if err != nil {
+						val, ok := state.Percent()
+						if !ok {
 							slog.Error(
 								"error remapping lighting value",
 								slog.Group("cell", slog.String("id", cell.ID), slog.String("desc", cell.Desc)),
-								slog.Any("error", err),
+								slog.String("value", state.Value),
 							)
 							continue
 						}
@@ -242,6 +320,224 @@ var configCommand = cli.Command{
 				return nil
 			},
 		},
+		{
+			Name:  "snapshot",
+			Usage: "Save the current merged config to compare it later",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "list",
+					Usage: "List saved snapshots instead",
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				if cmd.Bool("list") {
+					names, err := listSnapshots()
+					if err != nil {
+						return err
+					}
+
+					for _, name := range names {
+						fmt.Println(name)
+					}
+					return nil
+				}
+
+				config := internal.LoadWithFlags(cmd)
+
+				live, err := liveSnapshot(ctx, config)
+				if err != nil {
+					return err
+				}
+
+				path, err := writeSnapshot(live)
+				if err != nil {
+					return err
+				}
+
+				slog.Info("saved snapshot",
+					slog.String("path", path),
+					slog.String("project_version", live.ProjectVersion),
+					slog.Int("cells", len(live.Config.Cells())),
+				)
+				return nil
+			},
+		},
+		{
+			Name:      "diff",
+			Usage:     "Show how cells changed between two snapshots",
+			ArgsUsage: "[a (default: latest)] [b (default: live config)]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "output format, text or json",
+					Value: "text",
+				},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				format := cmd.String("format")
+				if format != "text" && format != "json" {
+					return fmt.Errorf("invalid format %q", format)
+				}
+				if cmd.Args().Len() > 2 {
+					return fmt.Errorf("too many arguments")
+				}
+
+				a := cmd.Args().Get(0)
+				if a == "" {
+					a = "latest"
+				}
+
+				from, err := readSnapshot(a)
+				if err != nil {
+					return err
+				}
+
+				var to *snapshot
+				if b := cmd.Args().Get(1); b != "" {
+					to, err = readSnapshot(b)
+				} else {
+					to, err = liveSnapshot(ctx, internal.LoadWithFlags(cmd))
+				}
+				if err != nil {
+					return err
+				}
+
+				diff := api.DiffConfigs(from.Config, to.Config)
+
+				if format == "json" {
+					type version struct {
+						Name           string
+						ProjectVersion string
+						CreatedAt      time.Time
+					}
+
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(struct {
+						From version
+						To   version
+						*api.ConfigDiff
+					}{
+						From:       version{from.Name, from.ProjectVersion, from.CreatedAt},
+						To:         version{to.Name, to.ProjectVersion, to.CreatedAt},
+						ConfigDiff: diff,
+					})
+				}
+
+				fmt.Printf("comparing %s with %s\n", from.label(), to.label())
+				if diff.Empty() {
+					fmt.Println("no changes")
+					return nil
+				}
+
+				for _, cell := range diff.Added {
+					fmt.Printf("+ %d %q (%s)\n", cell.ID, cell.Name, devices.Classify(cell).Kind())
+				}
+				for _, cell := range diff.Removed {
+					fmt.Printf("- %d %q (%s)\n", cell.ID, cell.Name, devices.Classify(cell).Kind())
+				}
+				for _, change := range diff.Changed {
+					fmt.Printf("~ %d %q\n", change.ID, change.Name)
+					for _, field := range change.Fields {
+						fmt.Printf("    %s: %q -> %q\n", field.Field, field.Old, field.New)
+					}
+				}
+
+				return nil
+			},
+		},
+	},
+}
+
+var cacheCommand = cli.Command{
+	Name:  "cache",
+	Usage: "Manage the cached configuration and state",
+	Commands: []*cli.Command{
+		{
+			Name:  "show",
+			Usage: "Print the cached objects and their last known state",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				config := internal.LoadWithFlags(cmd)
+
+				path, err := cachePath()
+				if err != nil {
+					return fmt.Errorf("failed to get cache path: %v", err)
+				}
+
+				c, err := readCache(config)
+				if err != nil {
+					return fmt.Errorf("no usable cache at %s: %v", path, err)
+				}
+
+				status, err := c.status()
+				if err != nil {
+					return fmt.Errorf("failed to parse cached status: %v", err)
+				}
+
+				fmt.Printf("path: %s\n", path)
+				fmt.Printf("email: %s\n", c.Email)
+				if c.Resource != "" {
+					fmt.Printf("resource: %s\n", c.Resource)
+				}
+				fmt.Printf("project version: %s\n", c.ProjectVersion)
+				fmt.Printf("updated at: %s\n", c.UpdatedAt.Format(time.RFC3339))
+				fmt.Printf("state updated at: %s\n", c.StatusUpdatedAt.Format(time.RFC3339))
+				fmt.Println()
+
+				w := tabwriter.NewWriter(os.Stdout, 8, 8, 1, ' ', 0)
+				defer w.Flush()
+
+				fmt.Fprintf(w, "id\tpanel\tname\tkind\tvalue\n")
+				for _, panel := range c.mergedConfig(config).Panels {
+					for _, cell := range panel.Cells {
+						var value string
+						if state, ok := status.Cells[cell.ID]; ok {
+							value = state.ValueStr
+						}
+
+						fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", cell.ID, panel.Name, cell.Name, devices.Classify(cell).Kind(), value)
+					}
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:  "refresh",
+			Usage: "Fetch the configuration and state and cache them",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				config := internal.LoadWithFlags(cmd)
+
+				client, err := highlevel.Connect(ctx, config, nil)
+				if err != nil {
+					return fmt.Errorf("failed to create api client: %v", err)
+				}
+
+				c, err := refreshCache(ctx, client, config)
+				if err != nil {
+					return fmt.Errorf("failed to refresh cache: %v", err)
+				}
+
+				slog.Info("refreshed cache",
+					slog.String("project_version", c.ProjectVersion),
+					slog.Int("cells", len(c.Config.Cells())),
+				)
+				return nil
+			},
+		},
+		{
+			Name:  "clear",
+			Usage: "Remove the cache",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				err := clearCache()
+				if err != nil {
+					return err
+				}
+
+				slog.Info("cleared cache")
+				return nil
+			},
+		},
 	},
 }
 
@@ -252,30 +548,23 @@ var eventCommand = cli.Command{
 		{
 			Name:  "watch",
 			Usage: "Print all incoming messages",
-			Action: func(ctx context.Context, c *cli.Command) error {
-				config := internal.Load()
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				config := internal.LoadWithFlags(cmd)
 
 				client, err := highlevel.Connect(ctx, config, nil)
 				if err != nil {
 					return fmt.Errorf("failed to create api client: %v", err)
 				}
 
-				for {
-					msg, err := client.ReadAnyMessage()
-					if err != nil {
-						return fmt.Errorf("failed to listen: %v", err)
-					}
-
-					if msg.ActionName == api.ActionStatusTouchesChanged {
-						var touches api.StatusTouchesChangedResponse
-						err = json.Unmarshal(msg.Raw, &touches)
-						if err != nil {
-							return fmt.Errorf("failed to unmarshal touches: %v", err)
-						}
+				for change := range client.Subscribe(ctx, api.CellFilter{}) {
+					log.Printf("%s\n", api.Pprint(change))
+				}
 
-						log.Printf("%s\n", api.Pprint(touches))
-					}
+				if err := client.Err(); err != nil {
+					return fmt.Errorf("failed to listen: %v", err)
 				}
+
+				return nil
 			},
 		},
 	},
@@ -291,67 +580,29 @@ var objectCommand = cli.Command{
 			Aliases:   []string{"t"},
 			Usage:     "Toggle object's state (on/off)",
 			ArgsUsage: "<object>",
+			Flags:     []cli.Flag{waitFlag},
 			Action: func(ctx context.Context, cmd *cli.Command) error {
 				object := cmd.Args().First()
 				if object == "" {
 					return fmt.Errorf("object not specified")
 				}
 
-				config := internal.Load()
+				config := internal.LoadWithFlags(cmd)
 
 				client, err := highlevel.Connect(ctx, config, nil)
 				if err != nil {
 					return fmt.Errorf("failed to create api client: %v", err)
 				}
 
-				objectID, err := strconv.Atoi(object)
+				cell, err := resolveObject(ctx, client, config, object, devices.KindSwitch, devices.KindDimmer, devices.KindGate)
 				if err != nil {
-					// string
-					log.Printf("looking for object with name %q", object)
-
-					userConfig, err := client.GetUserConfig(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to get user config: %v", err)
-					}
-
-					sysConfig, err := client.GetSystemConfig(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to get system config: %v", err)
-					}
-
-					config, err := api.MergeConfigs(userConfig, sysConfig)
-					if err != nil {
-						return fmt.Errorf("failed to merge configs: %v", err)
-					}
-
-					bestObject, bestScore := bestObjectMatch(object, config)
-					if bestObject == nil {
-						return fmt.Errorf("no matching object found, confidence is %d%%", int(bestScore*100))
-					}
-
-					log.Printf("selected object %q with id %d with %d%% confidence\n", bestObject.Name, bestObject.ID, int(bestScore*100))
-
-					err = client.SendEvent(ctx, bestObject.ID, api.ValueToggle)
-					if err != nil {
-						return fmt.Errorf("failed to send event to object %q with id %d", bestObject.Name, bestObject.ID)
-					}
-
-					log.Printf("sent event %s to object %q with id %d\n", api.ValueToggle, bestObject.Name, bestObject.ID)
-					return nil
-				} else {
-					// int
-
-					err = client.SendEvent(ctx, objectID, api.ValueToggle)
-					if err != nil {
-						return fmt.Errorf("failed to send event to object with id %d: %v", objectID, err)
-					}
-
-					log.Println("sent event to object with id", objectID)
-					return nil
+					return err
 				}
+
+				return sendEvent(ctx, cmd, client, config, cell, api.ValueToggle)
 			},
 			ShellComplete: func(ctx context.Context, cmd *cli.Command) {
-				userConfig, err := getUserConfig(ctx, createClientGetter(ctx))
+				userConfig, err := getUserConfig(ctx, internal.LoadWithFlags(cmd), createClientGetter(ctx, cmd))
 				if err != nil {
 					panic(err)
 				}
@@ -361,88 +612,545 @@ var objectCommand = cli.Command{
 				}
 			},
 		},
+		{
+			Name:      "on",
+			Usage:     "Turn object on, unless it's already on",
+			ArgsUsage: "<object>",
+			Flags:     []cli.Flag{waitFlag},
+			Action:    onOffAction(true),
+		},
+		{
+			Name:      "off",
+			Usage:     "Turn object off, unless it's already off",
+			ArgsUsage: "<object>",
+			Flags:     []cli.Flag{waitFlag},
+			Action:    onOffAction(false),
+		},
 		{
 			Name:      "set",
 			Aliases:   []string{"s"},
 			Usage:     "Set object's state (0-100)",
 			ArgsUsage: "<object> <0-100>",
+			Flags:     []cli.Flag{waitFlag},
 			Action: func(ctx context.Context, cmd *cli.Command) error {
 				object := cmd.Args().Get(0)
 				if object == "" {
 					return fmt.Errorf("object not specified")
 				}
 
-				value, err := strconv.Atoi(cmd.Args().Get(1))
+				percent, err := strconv.Atoi(cmd.Args().Get(1))
 				if err != nil {
 					return fmt.Errorf("invalid value: %v", err)
 				}
 
-				config := internal.Load()
+				config := internal.LoadWithFlags(cmd)
 
 				client, err := highlevel.Connect(ctx, config, nil)
 				if err != nil {
 					return fmt.Errorf("failed to create api client: %v", err)
 				}
 
-				objectID, err := strconv.Atoi(object)
+				cell, err := resolveObject(ctx, client, config, object, devices.KindSwitch, devices.KindDimmer)
 				if err != nil {
-					// string
-					slog.Info("looking for object", slog.String("name", object))
+					return err
+				}
 
-					userConfig, err := client.GetUserConfig(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to get user config: %v", err)
-					}
+				value, err := percentValue(devices.Classify(*cell), percent)
+				if err != nil {
+					return err
+				}
 
-					sysConfig, err := client.GetSystemConfig(ctx)
+				return sendEvent(ctx, cmd, client, config, cell, value)
+			},
+		},
+		{
+			Name:  "batch",
+			Usage: "Set state of many objects at once",
+			Description: "Each pair sets the object to a value, which is 0-100, on, off or toggle. An object can be set only once.\n" +
+				"If no pairs are given, they are read from stdin, one per line. Empty lines and lines starting with # are skipped.\n" +
+				"All events are sent together, so it's much faster than setting objects one by one.",
+			ArgsUsage: "[<object>=<value>...]",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				pairs := cmd.Args().Slice()
+				if len(pairs) == 0 {
+					var err error
+					pairs, err = readPairs(os.Stdin)
 					if err != nil {
-						return fmt.Errorf("failed to get system config: %v", err)
+						return fmt.Errorf("failed to read stdin: %v", err)
 					}
+				}
+				if len(pairs) == 0 {
+					return fmt.Errorf("no objects specified")
+				}
 
-					config, err := api.MergeConfigs(userConfig, sysConfig)
-					if err != nil {
-						return fmt.Errorf("failed to merge configs: %v", err)
-					}
+				config := internal.LoadWithFlags(cmd)
 
-					bestObject, bestScore := bestObjectMatch(object, config)
-					if bestObject == nil {
-						return fmt.Errorf("no matching object found, confidence is %d%%", int(bestScore*100))
-					}
+				client, err := highlevel.Connect(ctx, config, nil)
+				if err != nil {
+					return fmt.Errorf("failed to create api client: %v", err)
+				}
 
-					slog.Info("found best match",
-						slog.Int("confidence", int(bestScore*100)),
-						slog.Group("object", slog.String("name", bestObject.Name), slog.Int("id", bestObject.ID)),
-					)
+				events, err := parsePairs(ctx, client, config, pairs)
+				if err != nil {
+					return err
+				}
 
-					value := api.MapLighting(value)
-					err = client.SendEvent(ctx, bestObject.ID, value)
-					if err != nil {
-						return fmt.Errorf("failed to send event to object %q with id %d", bestObject.Name, bestObject.ID)
-					} else {
-						slog.Info("sent event to object",
-							slog.String("name", bestObject.Name),
-							slog.Int("id", bestObject.ID),
-							slog.String("value", value),
+				failed := 0
+				for _, result := range client.SendEvents(ctx, events) {
+					if result.Err != nil {
+						failed++
+						slog.Error("failed to send event to object",
+							slog.Int("id", result.CellID),
+							slog.String("value", result.Value),
+							slog.Any("error", result.Err),
 						)
-						return nil
-					}
-				} else {
-					err = client.SendEvent(ctx, objectID, api.MapLighting(value))
-					if err != nil {
-						return fmt.Errorf("sent event to object with id %d: %v", objectID, err)
+						continue
 					}
 
-					slog.Info("sent event to object", slog.Int("id", objectID), slog.String("value", api.MapLighting(value)))
-					return nil
+					slog.Info("sent event to object", slog.Int("id", result.CellID), slog.String("value", result.Value))
+				}
+
+				if failed > 0 {
+					return fmt.Errorf("failed to send %d of %d events", failed, len(events))
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:      "color",
+			Aliases:   []string{"c"},
+			Usage:     "Set color of an RGB object",
+			ArgsUsage: "<object> <#rrggbb|h,s,v>",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				object := cmd.Args().Get(0)
+				if object == "" {
+					return fmt.Errorf("object not specified")
+				}
+
+				color, err := api.ParseColor(cmd.Args().Get(1))
+				if err != nil {
+					return fmt.Errorf("invalid value: %v", err)
+				}
+
+				value, err := api.Encode(api.RGB, color)
+				if err != nil {
+					return fmt.Errorf("failed to encode color: %v", err)
+				}
+
+				config := internal.LoadWithFlags(cmd)
+
+				client, err := highlevel.Connect(ctx, config, nil)
+				if err != nil {
+					return fmt.Errorf("failed to create api client: %v", err)
+				}
+
+				cell, err := resolveObject(ctx, client, config, object, devices.KindRGBLight)
+				if err != nil {
+					return err
+				}
+				if err := checkConfirmed(config, cell, value); err != nil {
+					return err
+				}
+
+				err = client.SendEvent(ctx, cell.ID, value)
+				if err != nil {
+					return fmt.Errorf("failed to send event to object with id %d: %v", cell.ID, err)
+				}
+
+				slog.Info("sent event to object", slog.Int("id", cell.ID), slog.String("color", color.String()), slog.String("value", value))
+				return nil
+			},
+		},
+		{
+			Name:      "temperature",
+			Aliases:   []string{"temp"},
+			Usage:     "Set temperature of a thermostat (°C)",
+			ArgsUsage: "<object> <°C>",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				object := cmd.Args().Get(0)
+				if object == "" {
+					return fmt.Errorf("object not specified")
+				}
+
+				temperature, err := strconv.ParseFloat(cmd.Args().Get(1), 64)
+				if err != nil {
+					return fmt.Errorf("invalid value: %v", err)
+				}
+
+				config := internal.LoadWithFlags(cmd)
+
+				client, err := highlevel.Connect(ctx, config, nil)
+				if err != nil {
+					return fmt.Errorf("failed to create api client: %v", err)
+				}
+
+				cell, err := resolveObject(ctx, client, config, object, devices.KindThermostat)
+				if err != nil {
+					return err
+				}
+
+				thermostat, ok := devices.Classify(*cell).(*devices.Thermostat)
+				if !ok {
+					return fmt.Errorf("object %q with id %d is not a thermostat", cell.Name, cell.ID)
 				}
+
+				adjusted, value, err := thermostat.SetTarget(temperature)
+				if err != nil {
+					return fmt.Errorf("object %q with id %d: %v", cell.Name, cell.ID, err)
+				}
+				if adjusted != temperature {
+					slog.Warn("temperature adjusted to the range of the object", slog.Float64("requested", temperature), slog.Float64("adjusted", adjusted))
+				}
+
+				err = client.SendEvent(ctx, cell.ID, value)
+				if err != nil {
+					return fmt.Errorf("failed to send event to object with id %d: %v", cell.ID, err)
+				}
+
+				slog.Info("sent event to object", slog.Int("id", cell.ID), slog.String("value", value))
+				return nil
 			},
 		},
 	},
 }
 
-func createClientGetter(ctx context.Context) func() (*api.Client, error) {
+var blindCommand = cli.Command{
+	Name:  "blind",
+	Usage: "Control blinds and roller shutters",
+	Commands: []*cli.Command{
+		{
+			Name:      "up",
+			Usage:     "Fully open the blind",
+			ArgsUsage: "<object>",
+			Action: blindAction(func(blind *devices.Blind, args cli.Args) (string, error) {
+				return blind.Up(), nil
+			}),
+		},
+		{
+			Name:      "down",
+			Usage:     "Fully close the blind",
+			ArgsUsage: "<object>",
+			Action: blindAction(func(blind *devices.Blind, args cli.Args) (string, error) {
+				return blind.Down(), nil
+			}),
+		},
+		{
+			Name:      "stop",
+			Usage:     "Stop a moving blind (not supported yet, see README)",
+			ArgsUsage: "<object>",
+			Action: blindAction(func(blind *devices.Blind, args cli.Args) (string, error) {
+				return blind.Stop()
+			}),
+		},
+		{
+			Name:      "set",
+			Usage:     "Move the blind to a position (0 is closed, 100 is open)",
+			ArgsUsage: "<object> <0-100>",
+			Action: blindAction(func(blind *devices.Blind, args cli.Args) (string, error) {
+				position, err := strconv.Atoi(args.Get(1))
+				if err != nil {
+					return "", fmt.Errorf("invalid position: %v", err)
+				}
+
+				return blind.SetPosition(position), nil
+			}),
+		},
+	},
+}
+
+// onOffAction returns an action that turns the object named by the first
+// argument on or off. See [devices.OnOffValue].
+func onOffAction(on bool) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		object := cmd.Args().First()
+		if object == "" {
+			return fmt.Errorf("object not specified")
+		}
+
+		config := internal.LoadWithFlags(cmd)
+
+		client, err := highlevel.Connect(ctx, config, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create api client: %v", err)
+		}
+
+		// Loading the cache gets the live state, so objects that are toggled
+		// don't need another round trip to check it.
+		c, err := loadCache(ctx, client, config)
+		if err != nil {
+			return fmt.Errorf("failed to load cache: %v", err)
+		}
+		client.RecordPermissions(c.SystemConfig)
+
+		cell, err := c.resolve(config, object,
+			devices.KindSwitch, devices.KindDimmer, devices.KindRGBLight, devices.KindHeatingValve,
+		)
+		if err != nil {
+			return err
+		}
+
+		status, err := c.status()
+		if err != nil {
+			return fmt.Errorf("failed to parse cached status: %v", err)
+		}
+
+		value, err := devices.OnOffValueFromStatus(devices.Classify(*cell), on, config.Experimental, status)
+		if err != nil {
+			return fmt.Errorf("failed to turn object with id %d on or off: %w", cell.ID, err)
+		}
+		if value == "" {
+			slog.Info("object is already in the requested state", slog.Int("id", cell.ID), slog.Bool("on", on))
+			return nil
+		}
+
+		return sendEvent(ctx, cmd, client, config, cell, value)
+	}
+}
+
+// readPairs reads "object=value" pairs from r, one per line. Empty lines and
+// lines starting with # are skipped.
+func readPairs(r io.Reader) ([]string, error) {
+	var pairs []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pairs = append(pairs, line)
+	}
+
+	return pairs, scanner.Err()
+}
+
+// batchKinds are the kinds of objects that can be set by "object batch".
+var batchKinds = []devices.Kind{
+	devices.KindSwitch, devices.KindDimmer, devices.KindRGBLight, devices.KindGate, devices.KindHeatingValve,
+}
+
+// parsePairs returns the events that set objects as requested by
+// "object=value" pairs. The value is 0-100, on, off or toggle.
+//
+// Objects already on or off, as requested, are skipped. All pairs share a
+// single load of the cache, which also gets the live state, so that the number
+// of round trips doesn't grow with the number of pairs.
+func parsePairs(ctx context.Context, client *api.Client, config *highlevel.Config, pairs []string) ([]api.EventSpec, error) {
+	c, err := loadCache(ctx, client, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache: %v", err)
+	}
+	client.RecordPermissions(c.SystemConfig)
+
+	type request struct {
+		device devices.Device
+		value  string
+	}
+
+	status, err := c.status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cached status: %v", err)
+	}
+
+	// The state of an object is looked up before any event is sent, so a
+	// second pair for it would be resolved against a stale state.
+	seen := make(map[int]string, len(pairs))
+	requests := make([]request, 0, len(pairs))
+	for _, pair := range pairs {
+		// Object names may contain "=", values can't.
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid pair %q: expected <object>=<value>", pair)
+		}
+		object, value := strings.TrimSpace(pair[:i]), strings.ToLower(strings.TrimSpace(pair[i+1:]))
+		if object == "" {
+			return nil, fmt.Errorf("invalid pair %q: object not specified", pair)
+		}
+
+		cell, err := c.resolve(config, object, batchKinds...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pair %q: %w", pair, err)
+		}
+		if prev, ok := seen[cell.ID]; ok {
+			return nil, fmt.Errorf("invalid pair %q: object with id %d is already set by %q", pair, cell.ID, prev)
+		}
+		seen[cell.ID] = pair
+		requests = append(requests, request{device: devices.Classify(*cell), value: value})
+	}
+
+	events := make([]api.EventSpec, 0, len(requests))
+	for _, r := range requests {
+		id := r.device.Cell().ID
+
+		var value string
+		switch r.value {
+		case "toggle":
+			value = api.ValueToggle
+		case "on", "off":
+			value, err = devices.OnOffValueFromStatus(r.device, r.value == "on", config.Experimental, status)
+			if err != nil {
+				return nil, fmt.Errorf("object with id %d: %w", id, err)
+			}
+			if value == "" {
+				slog.Info("object is already in the requested state", slog.Int("id", id), slog.String("state", r.value))
+				continue
+			}
+		default:
+			percent, err := strconv.Atoi(r.value)
+			if err != nil {
+				return nil, fmt.Errorf("object with id %d: invalid value: %v", id, err)
+			}
+
+			value, err = percentValue(r.device, percent)
+			if err != nil {
+				return nil, fmt.Errorf("object with id %d: %w", id, err)
+			}
+		}
+
+		if err := checkConfirmed(config, r.device.Cell(), value); err != nil {
+			return nil, fmt.Errorf("object with id %d: %w", id, err)
+		}
+
+		events = append(events, api.EventSpec{CellID: id, Value: value})
+	}
+
+	return events, nil
+}
+
+// percentValue returns the value that sets d to percent. Only dimmers and
+// switches with percentage values accept it.
+func percentValue(d devices.Device, percent int) (string, error) {
+	switch d := d.(type) {
+	case *devices.Dimmer:
+		return d.SetBrightness(percent), nil
+	case *devices.Switch:
+		if api.DisplayType(d.Cell().DisplayType) == api.Percentage {
+			return api.MapLighting(percent), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s %q can't be set to a percentage, use on, off or toggle", d.Kind(), d.Cell().Name)
+}
+
+// blindAction returns an action that finds the blind named by the first
+// argument and sends it the value returned by value.
+func blindAction(value func(blind *devices.Blind, args cli.Args) (string, error)) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		object := cmd.Args().First()
+		if object == "" {
+			return fmt.Errorf("object not specified")
+		}
+
+		config := internal.LoadWithFlags(cmd)
+
+		client, err := highlevel.Connect(ctx, config, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create api client: %v", err)
+		}
+
+		cell, err := resolveObject(ctx, client, config, object, devices.KindBlind)
+		if err != nil {
+			return err
+		}
+
+		blind, ok := devices.Classify(*cell).(*devices.Blind)
+		if !ok {
+			return fmt.Errorf("object %q with id %d and type number %q is not a blind", cell.Name, cell.ID, cell.TypeNumber)
+		}
+
+		v, err := value(blind, cmd.Args())
+		if err != nil {
+			return err
+		}
+		if err := checkConfirmed(config, cell, v); err != nil {
+			return err
+		}
+
+		err = client.SendEvent(ctx, cell.ID, v)
+		if err != nil {
+			return fmt.Errorf("failed to send event to object with id %d: %v", cell.ID, err)
+		}
+
+		slog.Info("sent event to object", slog.Int("id", cell.ID), slog.String("value", v))
+		return nil
+	}
+}
+
+// checkConfirmed fails if value, sent to cell, is not confirmed to work with
+// real devices, unless the user opted in with FHOME_EXPERIMENTAL. See
+// [devices.Unconfirmed].
+func checkConfirmed(config *highlevel.Config, cell *api.Cell, value string) error {
+	if config.Experimental {
+		return nil
+	}
+
+	if err := devices.CheckConfirmed(devices.Classify(*cell), value); err != nil {
+		return fmt.Errorf("%w, set FHOME_EXPERIMENTAL=true to send it anyway", err)
+	}
+
+	return nil
+}
+
+// confirmTimeout is how long commands run with --wait wait for the object to
+// report its new state.
+const confirmTimeout = 10 * time.Second
+
+// waitFlag makes commands wait until the object reports its new state.
+var waitFlag = &cli.BoolFlag{
+	Name:  "wait",
+	Usage: "wait until the object reports its new state",
+}
+
+// sendEvent sends value to cell. If --wait is set, it waits for the object to
+// report the new state, see [api.Client.SetAndConfirm]. Then nothing is sent if
+// the cached state, which the callers have just refreshed, already has value.
+//
+// The confirmed state is recorded in the cache.
+func sendEvent(ctx context.Context, cmd *cli.Command, client *api.Client, config *highlevel.Config, cell *api.Cell, value string) error {
+	if err := checkConfirmed(config, cell, value); err != nil {
+		return err
+	}
+
+	if !cmd.Bool(waitFlag.Name) {
+		err := client.SendEvent(ctx, cell.ID, value)
+		if err != nil {
+			return fmt.Errorf("failed to send event to object with id %d: %v", cell.ID, err)
+		}
+
+		slog.Info("sent event to object", slog.Int("id", cell.ID), slog.String("value", value))
+		return nil
+	}
+
+	if value != api.ValueToggle {
+		if state, ok := cachedState(config, cell.ID); ok && strings.EqualFold(state.Value, value) {
+			slog.Info("object already has the value", slog.Int("id", cell.ID), slog.String("value", value))
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+
+	cv, err := client.SetAndConfirm(ctx, cell.ID, value)
+	if err != nil {
+		return fmt.Errorf("failed to set object with id %d: %w", cell.ID, err)
+	}
+
+	slog.Info("object confirmed new state",
+		slog.Int("id", cell.ID),
+		slog.String("value", cv.Value),
+		slog.String("value_str", cv.ValueStr),
+	)
+
+	recordValues(config, *cv)
+	return nil
+}
+
+func createClientGetter(ctx context.Context, cmd *cli.Command) func() (*api.Client, error) {
 	return func() (*api.Client, error) {
-		config := internal.Load()
+		config := internal.LoadWithFlags(cmd)
 		client, err := highlevel.Connect(ctx, config, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create api client: %v", err)
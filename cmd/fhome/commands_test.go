@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+	"github.com/bartekpacia/fhome/devices"
+	"github.com/urfave/cli/v3"
+)
+
+func TestParsePairs(t *testing.T) {
+	srv := fhometest.NewServer(t, fhometest.House{
+		Panels: []fhometest.Panel{
+			{ID: "1", Name: "Ground floor", Cells: []fhometest.Cell{
+				{ID: 300, Name: "Kitchen", DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 301, Name: "Lamp", DisplayType: api.Bit, Value: "0x0000"},
+				{ID: 302, Name: "LED strip", DisplayType: api.RGB, Value: "0x000000"},
+				{ID: 303, Name: "Gate", TypeNumber: "724", DisplayType: api.Bit, Value: "0x0001"},
+			}},
+		},
+	})
+	client, config := connect(t, srv)
+	config.Experimental = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := parsePairs(ctx, client, config, []string{"Kitchen=50", "Lamp=on", "303=toggle", "LED strip=toggle"})
+	if err != nil {
+		t.Fatalf("parsePairs() error = %v", err)
+	}
+
+	want := []api.EventSpec{
+		{CellID: 300, Value: "0x6032"},
+		{CellID: 301, Value: "0x0001"},
+		{CellID: 303, Value: api.ValueToggle},
+		{CellID: 302, Value: api.ValueToggle},
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("parsePairs() = %+v, want %+v", events, want)
+	}
+
+	for _, pair := range []string{"LED strip=50", "Lamp=50", "Gate=50", "Gate=on", "Gate=off", "Kitchen", "Kitchen=bright"} {
+		if _, err := parsePairs(ctx, client, config, []string{pair}); err == nil {
+			t.Errorf("parsePairs(%q) succeeded, want error", pair)
+		}
+	}
+
+	// Both pairs would be resolved against the same state.
+	if _, err := parsePairs(ctx, client, config, []string{"Lamp=on", "301=off"}); err == nil {
+		t.Errorf("parsePairs() of the same object twice succeeded, want error")
+	}
+
+	// Turning a bit on isn't confirmed, so it's toggled instead.
+	config.Experimental = false
+	events, err = parsePairs(ctx, client, config, []string{"Lamp=on"})
+	if err != nil {
+		t.Fatalf("parsePairs() error = %v", err)
+	}
+	want = []api.EventSpec{{CellID: 301, Value: api.ValueToggle}}
+	if !slices.Equal(events, want) {
+		t.Errorf("parsePairs() = %+v, want %+v", events, want)
+	}
+	if _, err := parsePairs(ctx, client, config, []string{"LED strip=on"}); !errors.Is(err, devices.ErrUnconfirmed) {
+		t.Errorf("parsePairs(LED strip=on) error = %v, want %v", err, devices.ErrUnconfirmed)
+	}
+}
+
+// runCommand runs cmd with args as if it was run by the fhome binary,
+// configured to connect to srv.
+func runCommand(t *testing.T, srv *fhometest.Server, cmd *cli.Command, args ...string) error {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("FHOME_EMAIL", fhometest.Email)
+	t.Setenv("FHOME_CLOUD_PASSWORD", fhometest.Password)
+	t.Setenv("FHOME_RESOURCE_PASSWORD", fhometest.ResourcePassword)
+	t.Setenv("FHOME_URL", srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return cmd.Run(ctx, append([]string{cmd.Name}, args...))
+}
+
+func TestObjectSet(t *testing.T) {
+	srv := fhometest.NewServer(t, testHouse)
+
+	if err := runCommand(t, srv, &objectCommand, "set", "Kitchen", "50"); err != nil {
+		t.Fatalf("object set Kitchen error = %v", err)
+	}
+
+	// A bit can't be set to a percentage.
+	if err := runCommand(t, srv, &objectCommand, "set", "Lamp", "50"); err == nil {
+		t.Errorf("object set Lamp succeeded, want error")
+	}
+
+	want := []fhometest.Event{{CellID: 300, Value: "0x6032"}}
+	got := srv.Events()
+	if len(got) != len(want) || got[0].CellID != want[0].CellID || got[0].Value != want[0].Value {
+		t.Errorf("server received %+v, want %+v", got, want)
+	}
+}
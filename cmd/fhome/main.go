@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/bartekpacia/fhome/internal"
 	"github.com/lmittmann/tint"
 	"github.com/urfave/cli/v3"
 )
@@ -43,6 +44,8 @@ func main() {
 				Name:  "debug",
 				Usage: "show debug logs (can also be enabled with FHOME_DEBUG env var)",
 			},
+			internal.ResourceFlag,
+			internal.UnassignedFlag,
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			if cmd.Bool("debug") {
@@ -64,6 +67,9 @@ func main() {
 			return ctx, nil
 		},
 		Commands: []*cli.Command{
+			&accountCommand,
+			&blindCommand,
+			&cacheCommand,
 			&configCommand,
 			&eventCommand,
 			&objectCommand,
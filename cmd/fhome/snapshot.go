@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/highlevel"
+)
+
+// snapshot is a merged config saved at some point in time, used to find out
+// what changed after the project was changed in the configurator app.
+type snapshot struct {
+	// Name of the snapshot file, without the extension. Empty for the live
+	// config.
+	Name string `json:"-"`
+
+	ProjectVersion string
+	CreatedAt      time.Time
+	// Merged config, including cells that are not placed in any panel.
+	Config *api.Config
+}
+
+// label returns a short description of s.
+func (s *snapshot) label() string {
+	name := s.Name
+	if name == "" {
+		name = "live"
+	}
+
+	return fmt.Sprintf("%s (project version %s)", name, s.ProjectVersion)
+}
+
+// snapshotDir returns the path to the directory with snapshots.
+func snapshotDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	dir := filepath.Join(homeDir, ".local", "state", "fhome", "snapshots")
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// snapshotNameFormat is the layout of snapshot names. They have millisecond
+// precision and a fixed width, so that they sort chronologically.
+const snapshotNameFormat = "20060102T150405.000Z"
+
+// writeSnapshot saves s under a name made of its creation time and returns the
+// path to it. It fails rather than overwrite an existing snapshot.
+func writeSnapshot(s *snapshot) (string, error) {
+	dir, err := snapshotDir()
+	if err != nil {
+		return "", err
+	}
+
+	s.Name = s.CreatedAt.UTC().Format(snapshotNameFormat)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+
+	path := filepath.Join(dir, s.Name+".json")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+
+	return path, nil
+}
+
+// listSnapshots returns the names of saved snapshots, oldest first.
+func listSnapshots() ([]string, error) {
+	dir, err := snapshotDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+
+	// Names are timestamps, so they sort chronologically.
+	slices.Sort(names)
+	return names, nil
+}
+
+// readSnapshot reads the snapshot identified by arg, which is either a path to
+// a file, a name of a saved snapshot or "latest".
+func readSnapshot(arg string) (*snapshot, error) {
+	path := arg
+	if _, err := os.Stat(path); err != nil {
+		names, err := listSnapshots()
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(arg, ".json")
+		if name == "latest" {
+			if len(names) == 0 {
+				return nil, errors.New("no snapshots saved, run 'fhome config snapshot' first")
+			}
+			name = names[len(names)-1]
+		} else if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("no snapshot %q", arg)
+		}
+
+		dir, err := snapshotDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, name+".json")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+
+	var s snapshot
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot file: %w", err)
+	}
+	if s.Config == nil {
+		return nil, fmt.Errorf("snapshot file %s has no config", path)
+	}
+
+	s.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	return &s, nil
+}
+
+// liveSnapshot fetches the current merged config. It refreshes the cache on
+// the way, since it fetches the same data.
+func liveSnapshot(ctx context.Context, config *highlevel.Config) (*snapshot, error) {
+	client, err := highlevel.Connect(ctx, config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api client: %v", err)
+	}
+
+	c, err := refreshCache(ctx, client, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %v", err)
+	}
+
+	return &snapshot{
+		ProjectVersion: c.ProjectVersion,
+		CreatedAt:      c.UpdatedAt,
+		Config:         c.Config,
+	}, nil
+}
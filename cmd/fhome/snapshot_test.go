@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	createdAt := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	newSnapshot := func(at time.Time) *snapshot {
+		return &snapshot{ProjectVersion: "1", CreatedAt: at, Config: &api.Config{}}
+	}
+
+	// Two snapshots in the same second.
+	for _, at := range []time.Time{createdAt, createdAt.Add(250 * time.Millisecond)} {
+		if _, err := writeSnapshot(newSnapshot(at)); err != nil {
+			t.Fatalf("writeSnapshot() error = %v", err)
+		}
+	}
+
+	names, err := listSnapshots()
+	if err != nil {
+		t.Fatalf("listSnapshots() error = %v", err)
+	}
+	want := []string{"20261017T120000.000Z", "20261017T120000.250Z"}
+	if !slices.Equal(names, want) {
+		t.Errorf("listSnapshots() = %v, want %v", names, want)
+	}
+
+	_, err = writeSnapshot(newSnapshot(createdAt))
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("writeSnapshot() of an existing name error = %v, want os.ErrExist", err)
+	}
+
+	s, err := readSnapshot("latest")
+	if err != nil {
+		t.Fatalf("readSnapshot() error = %v", err)
+	}
+	if s.Name != want[1] {
+		t.Errorf("latest snapshot is %q, want %q", s.Name, want[1])
+	}
+}
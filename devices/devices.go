@@ -0,0 +1,415 @@
+// Package devices classifies cells of F&Home into kinds of devices and encodes
+// values to control them.
+//
+// F&Home doesn't say what a cell controls, so the kind is inferred from the
+// type number, display type, icon, permission and step of the cell, as
+// observed in real configurations.
+package devices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bartekpacia/fhome/api"
+)
+
+// Kind is a kind of device.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindSwitch
+	KindDimmer
+	KindRGBLight
+	KindThermostat
+	KindTemperatureSensor
+	KindGate
+	KindBlind
+	KindHeatingValve
+	KindSensor
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindSwitch:
+		return "switch"
+	case KindDimmer:
+		return "dimmer"
+	case KindRGBLight:
+		return "rgb light"
+	case KindThermostat:
+		return "thermostat"
+	case KindTemperatureSensor:
+		return "temperature sensor"
+	case KindGate:
+		return "gate"
+	case KindBlind:
+		return "blind"
+	case KindHeatingValve:
+		return "heating valve"
+	case KindSensor:
+		return "sensor"
+	default:
+		return "unknown"
+	}
+}
+
+// Type numbers of cells. They match the numbers in names of icons, see
+// [api.Icon].
+const (
+	// Not confirmed with captured traffic or a configurator export, inferred
+	// from the order of icons in the apps.
+	typeBlind = "711"
+	// See [api.IconHeating].
+	typeHeating = "717"
+	// See [api.IconGate].
+	typeGate = "724"
+)
+
+const (
+	// Step of [api.Percentage] cells that can only be fully on or off.
+	stepOnOff = "0x6064"
+	// Step of 0.5°C, which [api.Temperature] cells that can be set usually
+	// have. Only used for cells whose permission is unknown.
+	stepTemperatureSetter = "0xa005"
+)
+
+// Device is a cell classified into a kind. It is one of [*Switch], [*Dimmer],
+// [*RGBLight], [*Thermostat], [*TemperatureSensor], [*Gate], [*Blind],
+// [*HeatingValve], [*Sensor] or [*Unknown].
+type Device interface {
+	// Cell returns the cell that the device was classified from.
+	Cell() *api.Cell
+	// Kind returns the kind of the device.
+	Kind() Kind
+}
+
+// ErrUnconfirmed is returned for values that are inferred, rather than
+// confirmed with captured traffic, see [Unconfirmed].
+var ErrUnconfirmed = errors.New("value is not confirmed to work with real devices")
+
+// Unconfirmed reports whether d can only be set with values that are
+// inferred, rather than confirmed with captured traffic. These are [*Blind] and
+// [*RGBLight], see [api.Encode]. Apps should only expose them if the user opted
+// in.
+//
+// A [*Switch] with an [api.Bit] cell is turned on and off with inferred values
+// too, but it can be toggled instead, see [OnOffValue].
+func Unconfirmed(d Device) bool {
+	switch d.(type) {
+	case *Blind, *RGBLight:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckConfirmed returns an error wrapping [ErrUnconfirmed] if value, sent to d,
+// is not confirmed. [api.ValueToggle] is confirmed for all devices.
+func CheckConfirmed(d Device, value string) error {
+	if value == api.ValueToggle {
+		return nil
+	}
+
+	unconfirmed := Unconfirmed(d)
+	if s, ok := d.(*Switch); ok && s.bit() {
+		unconfirmed = true
+	}
+	if !unconfirmed {
+		return nil
+	}
+
+	return fmt.Errorf("%s %q: %w", d.Kind(), d.Cell().Name, ErrUnconfirmed)
+}
+
+// ErrNoStop is returned for stopping a [*Blind]. The value that does it needs
+// to be captured from the traffic of an official app stopping a blind.
+var ErrNoStop = errors.New("the value that stops a moving blind is not known")
+
+type device struct {
+	cell api.Cell
+}
+
+func (d *device) Cell() *api.Cell { return &d.cell }
+
+// Classify returns the device controlled by cell.
+func Classify(cell api.Cell) Device {
+	d := device{cell: cell}
+
+	// Read-only cells can't control anything, whatever they look like.
+	if cell.ReadOnly() {
+		if api.DisplayType(cell.DisplayType) == api.Temperature {
+			return &TemperatureSensor{d}
+		}
+		return &Sensor{d}
+	}
+
+	// These display types are specific enough on their own.
+	switch api.DisplayType(cell.DisplayType) {
+	case api.RGB:
+		return &RGBLight{d}
+	case api.Temperature:
+		// Read-only cells are sensors, see above. Without a permission, e.g.
+		// in an old cache, the usual step of setpoints is the best guess.
+		if cell.Permission == api.PermissionFullControl || cell.Step == stepTemperatureSetter {
+			return &Thermostat{d}
+		}
+		return &TemperatureSensor{d}
+	}
+
+	switch typeNumber(&cell) {
+	case typeGate:
+		return &Gate{d}
+	case typeBlind:
+		// The values of Blind only make sense for a percentage, and other
+		// values of a blind shouldn't be mistaken for a switch.
+		if api.DisplayType(cell.DisplayType) == api.Percentage {
+			return &Blind{d}
+		}
+		return &Unknown{d}
+	case typeHeating:
+		return &HeatingValve{d}
+	}
+
+	switch api.DisplayType(cell.DisplayType) {
+	case api.Percentage:
+		if cell.Step == stepOnOff {
+			return &Switch{d}
+		}
+		return &Dimmer{d}
+	case api.Bit:
+		return &Switch{d}
+	}
+
+	return &Unknown{d}
+}
+
+// FromConfig classifies all cells of cfg.
+func FromConfig(cfg *api.Config) []Device {
+	cells := cfg.Cells()
+	devices := make([]Device, 0, len(cells))
+	for _, cell := range cells {
+		devices = append(devices, Classify(cell))
+	}
+
+	return devices
+}
+
+// typeNumber returns the type number of cell, falling back to the number in
+// the name of its icon.
+func typeNumber(cell *api.Cell) string {
+	if cell.TypeNumber != "" {
+		return cell.TypeNumber
+	}
+
+	icon := strings.TrimPrefix(string(cell.Icon), "icon_cell_")
+	number, _, _ := strings.Cut(icon, "_")
+	return number
+}
+
+// Unknown is a device of an unknown kind.
+type Unknown struct{ device }
+
+func (*Unknown) Kind() Kind { return KindUnknown }
+
+// Switch is a device that can only be on or off, e.g. a light without dimming.
+type Switch struct{ device }
+
+func (*Switch) Kind() Kind { return KindSwitch }
+
+// On returns the value that turns the switch on.
+func (s *Switch) On() string { return s.set(true) }
+
+// Off returns the value that turns the switch off.
+func (s *Switch) Off() string { return s.set(false) }
+
+// Toggle returns the value that toggles the switch.
+func (s *Switch) Toggle() string { return api.ValueToggle }
+
+func (s *Switch) set(on bool) string {
+	// Not confirmed, see [CheckConfirmed].
+	if s.bit() {
+		v, _ := api.Encode(api.Bit, on)
+		return v
+	}
+
+	if on {
+		return api.MapLighting(100)
+	}
+	return api.MapLighting(0)
+}
+
+// bit reports whether the switch is an [api.Bit] cell.
+func (s *Switch) bit() bool { return api.DisplayType(s.cell.DisplayType) == api.Bit }
+
+// Dimmer is a light with adjustable brightness.
+type Dimmer struct{ device }
+
+func (*Dimmer) Kind() Kind { return KindDimmer }
+
+// On returns the value that sets the brightness to 100%.
+func (d *Dimmer) On() string { return api.MapLighting(100) }
+
+// Off returns the value that sets the brightness to 0%.
+func (d *Dimmer) Off() string { return api.MapLighting(0) }
+
+// Toggle returns the value that toggles the light.
+func (d *Dimmer) Toggle() string { return api.ValueToggle }
+
+// SetBrightness returns the value that sets the brightness to percent, clamped
+// to 0-100.
+func (d *Dimmer) SetBrightness(percent int) string { return api.MapLighting(percent) }
+
+// RGBLight is a light with adjustable color.
+//
+// The values setting the color are not confirmed, see [Unconfirmed].
+type RGBLight struct{ device }
+
+func (*RGBLight) Kind() Kind { return KindRGBLight }
+
+// On returns the value that sets the color to white.
+func (l *RGBLight) On() string { return l.SetColor(api.Color{R: 0xff, G: 0xff, B: 0xff}) }
+
+// Off returns the value that sets the color to black.
+func (l *RGBLight) Off() string { return l.SetColor(api.Color{}) }
+
+// SetColor returns the value that sets the color to c.
+func (l *RGBLight) SetColor(c api.Color) string {
+	v, _ := api.Encode(api.RGB, c)
+	return v
+}
+
+// Thermostat is a device with a settable target temperature.
+type Thermostat struct{ device }
+
+func (*Thermostat) Kind() Kind { return KindThermostat }
+
+// Range returns the range of temperatures accepted by the thermostat, or
+// [api.DefaultTemperatureRange] if the cell doesn't specify one. It fails if
+// the range of the cell is malformed.
+func (t *Thermostat) Range() (api.TemperatureRange, error) {
+	if t.cell.MinValue == "" && t.cell.MaxValue == "" {
+		return api.DefaultTemperatureRange, nil
+	}
+
+	return t.cell.TemperatureRange()
+}
+
+// SetTarget returns the target temperature that celsius is adjusted to, that
+// is clamped and rounded to the range of the thermostat, and the value that
+// sets it. It fails if the range is malformed, see [Thermostat.Range].
+func (t *Thermostat) SetTarget(celsius float64) (float64, string, error) {
+	r, err := t.Range()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return r.Clamp(celsius), r.Encode(celsius), nil
+}
+
+// TemperatureSensor is a device that only reports temperature.
+type TemperatureSensor struct{ device }
+
+func (*TemperatureSensor) Kind() Kind { return KindTemperatureSensor }
+
+// Temperature returns the last known temperature. It fails if the cell has no
+// live value, see [api.Config.ApplyStatus].
+func (s *TemperatureSensor) Temperature() (float64, error) {
+	if s.cell.Value == "" {
+		return 0, fmt.Errorf("cell %d has no value", s.cell.ID)
+	}
+
+	v, err := api.Decode(api.CellValue{
+		DisplayType: api.Temperature,
+		Value:       s.cell.Value,
+		ValueStr:    s.cell.ValueStr,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(v.(api.Celsius)), nil
+}
+
+// Gate is a gate or a garage door, controlled with a single impulse.
+type Gate struct{ device }
+
+func (*Gate) Kind() Kind { return KindGate }
+
+// Open returns the value that sends an impulse to the gate. Depending on the
+// state of the gate, the impulse opens, stops or closes it.
+func (g *Gate) Open() string { return api.ValueToggle }
+
+// Blind is a window blind or a roller shutter.
+//
+// Only [api.Percentage] cells are classified as blinds.
+//
+// Neither the type number of blinds nor the values controlling them are
+// confirmed with captured traffic. They are inferred from how other devices
+// behave: the position is a percentage, like the brightness of a [Dimmer],
+// where 0% is fully closed and 100% is fully open. Apps should only send them
+// if the user opted in.
+//
+// The value that stops a moving blind isn't known, see [Blind.Stop].
+type Blind struct{ device }
+
+func (*Blind) Kind() Kind { return KindBlind }
+
+// Up returns the value that fully opens the blind.
+func (b *Blind) Up() string { return b.SetPosition(100) }
+
+// Down returns the value that fully closes the blind.
+func (b *Blind) Down() string { return b.SetPosition(0) }
+
+// Stop fails with [ErrNoStop]. An impulse, like the one sent to a [Gate],
+// might stop a moving blind, but it might as well start one that isn't moving.
+func (b *Blind) Stop() (string, error) {
+	return "", fmt.Errorf("%s %q: %w", b.Kind(), b.cell.Name, ErrNoStop)
+}
+
+// SetPosition returns the value that moves the blind to percent open, clamped
+// to 0-100.
+func (b *Blind) SetPosition(percent int) string { return api.MapLighting(percent) }
+
+// Position returns the last known position of the blind, in percent open. It
+// fails if the cell has no live value, see [api.Config.ApplyStatus].
+func (b *Blind) Position() (int, error) {
+	if b.cell.Value == "" {
+		return 0, fmt.Errorf("cell %d has no value", b.cell.ID)
+	}
+
+	v, err := api.Decode(api.CellValue{DisplayType: api.Percentage, Value: b.cell.Value})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(v.(api.Percent)), nil
+}
+
+// Sensor is a read-only cell other than a [TemperatureSensor].
+type Sensor struct{ device }
+
+func (*Sensor) Kind() Kind { return KindSensor }
+
+// Value returns the last known value, as returned by [api.Decode]. It fails if
+// the cell has no live value, see [api.Config.ApplyStatus].
+func (s *Sensor) Value() (any, error) {
+	if s.cell.Value == "" {
+		return nil, fmt.Errorf("cell %d has no value", s.cell.ID)
+	}
+
+	return api.Decode(api.CellValue{
+		DisplayType: api.DisplayType(s.cell.DisplayType),
+		Value:       s.cell.Value,
+		ValueStr:    s.cell.ValueStr,
+	})
+}
+
+// HeatingValve is a valve of a heating circuit.
+type HeatingValve struct{ device }
+
+func (*HeatingValve) Kind() Kind { return KindHeatingValve }
+
+// Toggle returns the value that toggles the valve.
+func (v *HeatingValve) Toggle() string { return api.ValueToggle }
@@ -0,0 +1,252 @@
+package devices
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bartekpacia/fhome/api"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		cell api.Cell
+		want Kind
+	}{
+		{
+			name: "On/off light",
+			cell: api.Cell{TypeNumber: "710", DisplayType: string(api.Percentage), Step: "0x6064"},
+			want: KindSwitch,
+		},
+		{
+			name: "Dimmable light",
+			cell: api.Cell{TypeNumber: "710", DisplayType: string(api.Percentage), Step: "0x6001"},
+			want: KindDimmer,
+		},
+		{
+			name: "Bit",
+			cell: api.Cell{DisplayType: string(api.Bit)},
+			want: KindSwitch,
+		},
+		{
+			name: "RGB light",
+			cell: api.Cell{TypeNumber: "710", DisplayType: string(api.RGB)},
+			want: KindRGBLight,
+		},
+		{
+			name: "Thermostat",
+			cell: api.Cell{TypeNumber: "706", DisplayType: string(api.Temperature), Step: "0xa005"},
+			want: KindThermostat,
+		},
+		{
+			name: "Thermostat with a step of 1°C",
+			cell: api.Cell{TypeNumber: "706", DisplayType: string(api.Temperature), Step: "0xa00a", Permission: api.PermissionFullControl},
+			want: KindThermostat,
+		},
+		{
+			name: "Temperature sensor",
+			cell: api.Cell{TypeNumber: "706", DisplayType: string(api.Temperature), Step: "0xa005", Permission: api.PermissionReadOnly},
+			want: KindTemperatureSensor,
+		},
+		{
+			name: "Temperature sensor without permission",
+			cell: api.Cell{TypeNumber: "706", DisplayType: string(api.Temperature), Step: "0xa0fa"},
+			want: KindTemperatureSensor,
+		},
+		{
+			name: "Heating zone with a thermostat",
+			cell: api.Cell{TypeNumber: "717", DisplayType: string(api.Temperature), Step: "0xa005"},
+			want: KindThermostat,
+		},
+		{
+			name: "Gate",
+			cell: api.Cell{TypeNumber: "724", DisplayType: string(api.Percentage), Step: "0x6064"},
+			want: KindGate,
+		},
+		{
+			name: "Gate recognized by icon",
+			cell: api.Cell{Icon: api.IconGate, DisplayType: string(api.Percentage)},
+			want: KindGate,
+		},
+		{
+			name: "Blind",
+			cell: api.Cell{TypeNumber: "711", DisplayType: string(api.Percentage)},
+			want: KindBlind,
+		},
+		{
+			name: "Blind type without percentage",
+			cell: api.Cell{TypeNumber: "711", DisplayType: string(api.Bit)},
+			want: KindUnknown,
+		},
+		{
+			name: "Heating valve",
+			cell: api.Cell{TypeNumber: "717", DisplayType: string(api.Percentage)},
+			want: KindHeatingValve,
+		},
+		{
+			name: "Read-only thermostat",
+			cell: api.Cell{DisplayType: string(api.Temperature), Step: "0xa005", Permission: api.PermissionReadOnly},
+			want: KindTemperatureSensor,
+		},
+		{
+			name: "Read-only light",
+			cell: api.Cell{TypeNumber: "710", DisplayType: string(api.Percentage), Permission: api.PermissionReadOnly},
+			want: KindSensor,
+		},
+		{
+			name: "Unknown",
+			cell: api.Cell{TypeNumber: "707", DisplayType: string(api.Byte)},
+			want: KindUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.cell).Kind()
+			if got != tt.want {
+				t.Errorf("Classify().Kind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMethods(t *testing.T) {
+	thermostat := Classify(api.Cell{
+		DisplayType: string(api.Temperature),
+		MinValue:    "0xa032",
+		MaxValue:    "0xa190",
+		Step:        "0xa005",
+	}).(*Thermostat)
+	adjusted, target, err := thermostat.SetTarget(5)
+	if err != nil {
+		t.Fatalf("SetTarget() error = %v", err)
+	}
+	if adjusted != 5 {
+		t.Errorf("SetTarget() adjusted to %v, want 5", adjusted)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{
+			name: "Switch on",
+			got:  Classify(api.Cell{DisplayType: string(api.Percentage), Step: "0x6064"}).(*Switch).On(),
+			want: "0x6064",
+		},
+		{
+			name: "Bit switch off",
+			got:  Classify(api.Cell{DisplayType: string(api.Bit)}).(*Switch).Off(),
+			want: "0x0000",
+		},
+		{
+			name: "Dimmer brightness",
+			got:  Classify(api.Cell{DisplayType: string(api.Percentage)}).(*Dimmer).SetBrightness(30),
+			want: "0x601e",
+		},
+		{
+			name: "RGB color",
+			got:  Classify(api.Cell{DisplayType: string(api.RGB)}).(*RGBLight).SetColor(api.Color{R: 0xff}),
+			want: "0xff0000",
+		},
+		{
+			name: "Thermostat below default range",
+			got:  target,
+			want: "0xa032",
+		},
+		{
+			name: "Blind up",
+			got:  Classify(api.Cell{TypeNumber: "711", DisplayType: string(api.Percentage)}).(*Blind).Up(),
+			want: "0x6064",
+		},
+		{
+			name: "Blind position",
+			got:  Classify(api.Cell{TypeNumber: "711", DisplayType: string(api.Percentage)}).(*Blind).SetPosition(40),
+			want: "0x6028",
+		},
+		{
+			name: "Gate",
+			got:  Classify(api.Cell{TypeNumber: "724"}).(*Gate).Open(),
+			want: api.ValueToggle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfirmed(t *testing.T) {
+	tests := []struct {
+		name    string
+		cell    api.Cell
+		value   string
+		wantErr bool
+	}{
+		{
+			name:  "Percentage switch on",
+			cell:  api.Cell{DisplayType: string(api.Percentage), Step: "0x6064"},
+			value: "0x6064",
+		},
+		{
+			name:    "Bit switch on",
+			cell:    api.Cell{DisplayType: string(api.Bit)},
+			value:   "0x0001",
+			wantErr: true,
+		},
+		{
+			name:  "Bit switch toggle",
+			cell:  api.Cell{DisplayType: string(api.Bit)},
+			value: api.ValueToggle,
+		},
+		{
+			name:    "RGB color",
+			cell:    api.Cell{DisplayType: string(api.RGB)},
+			value:   "0xff0000",
+			wantErr: true,
+		},
+		{
+			name:    "Blind position",
+			cell:    api.Cell{TypeNumber: "711", DisplayType: string(api.Percentage)},
+			value:   "0x6028",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckConfirmed(Classify(tt.cell), tt.value)
+			if tt.wantErr != errors.Is(err, ErrUnconfirmed) {
+				t.Errorf("CheckConfirmed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestThermostatRange(t *testing.T) {
+	thermostat := func(minValue, maxValue string) *Thermostat {
+		return Classify(api.Cell{
+			DisplayType: string(api.Temperature),
+			MinValue:    minValue,
+			MaxValue:    maxValue,
+			Step:        "0xa005",
+		}).(*Thermostat)
+	}
+
+	got, err := thermostat("", "").Range()
+	if err != nil || got != api.DefaultTemperatureRange {
+		t.Errorf("Range() without a range = %v, %v, want %v", got, err, api.DefaultTemperatureRange)
+	}
+
+	if _, err := thermostat("0xa190", "0xa032").Range(); err == nil {
+		t.Errorf("Range() with min above max succeeded, want error")
+	}
+	if _, _, err := thermostat("0xa032", "bogus").SetTarget(20); err == nil {
+		t.Errorf("SetTarget() with malformed max succeeded, want error")
+	}
+}
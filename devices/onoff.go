@@ -0,0 +1,134 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bartekpacia/fhome/api"
+)
+
+// ErrUnsupported is returned for devices that can't be turned on and off.
+var ErrUnsupported = errors.New("device can't be turned on or off")
+
+// OnOff is a device with explicit values that turn it on and off. Sending them
+// is idempotent, unlike toggling.
+//
+// [*Switch], [*Dimmer] and [*RGBLight] are OnOff.
+type OnOff interface {
+	Device
+	On() string
+	Off() string
+}
+
+// OnOffValue returns the value that turns d on or off.
+//
+// A [*HeatingValve] can only be toggled, so the live state of the cell is
+// checked with client first. If the valve is already in the requested state,
+// it returns "".
+//
+// A [*Gate] isn't supported. It's controlled with an impulse, see [Gate.Open],
+// and gates driven that way report the same value whether they're open or
+// closed, so there's no state to check.
+//
+// The values that turn a [*Switch] with an [api.Bit] cell on and off are not
+// confirmed, see [Unconfirmed]. Unless experimental is set, such a switch is
+// toggled like a valve instead.
+func OnOffValue(ctx context.Context, client *api.Client, d Device, on, experimental bool) (string, error) {
+	var status *api.Status
+	if needsState(d, experimental) {
+		var err error
+		status, err = client.GetStatus(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get state of cell %d: %w", d.Cell().ID, err)
+		}
+	}
+
+	return OnOffValueFromStatus(d, on, experimental, status)
+}
+
+// OnOffValueFromStatus is like [OnOffValue], but the live state of devices that
+// are toggled is looked up in status, so that many devices can share one
+// [api.Client.GetStatus]. For other devices, status may be nil.
+func OnOffValueFromStatus(d Device, on, experimental bool, status *api.Status) (string, error) {
+	if needsState(d, experimental) {
+		if status == nil {
+			return "", fmt.Errorf("no state of cell %d", d.Cell().ID)
+		}
+		state, ok := status.Cells[d.Cell().ID]
+		if !ok {
+			return "", fmt.Errorf("no state of cell %d", d.Cell().ID)
+		}
+
+		isOn, err := isOn(state)
+		if err != nil {
+			return "", err
+		}
+		if isOn == on {
+			return "", nil
+		}
+
+		return api.ValueToggle, nil
+	}
+
+	switch d := d.(type) {
+	case OnOff:
+		if on {
+			return d.On(), nil
+		}
+		return d.Off(), nil
+	case *Gate:
+		return "", fmt.Errorf("%s %q is controlled with an impulse, toggle it instead: %w", d.Kind(), d.Cell().Name, ErrUnsupported)
+	default:
+		return "", fmt.Errorf("%s %q: %w", d.Kind(), d.Cell().Name, ErrUnsupported)
+	}
+}
+
+// needsState reports whether d is turned on and off by toggling, which depends
+// on its live state.
+func needsState(d Device, experimental bool) bool {
+	switch d := d.(type) {
+	case *HeatingValve:
+		return true
+	case *Switch:
+		return !experimental && d.bit()
+	default:
+		return false
+	}
+}
+
+// TurnOn turns d on, unless it's already on. See [OnOffValue].
+func TurnOn(ctx context.Context, client *api.Client, d Device, experimental bool) error {
+	return turn(ctx, client, d, true, experimental)
+}
+
+// TurnOff turns d off, unless it's already off. See [OnOffValue].
+func TurnOff(ctx context.Context, client *api.Client, d Device, experimental bool) error {
+	return turn(ctx, client, d, false, experimental)
+}
+
+func turn(ctx context.Context, client *api.Client, d Device, on, experimental bool) error {
+	value, err := OnOffValue(ctx, client, d, on, experimental)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return nil
+	}
+
+	return client.SendEvent(ctx, d.Cell().ID, value)
+}
+
+// isOn reports whether the live value in state means "on".
+func isOn(state api.CellState) (bool, error) {
+	switch v := state.Decoded.(type) {
+	case bool:
+		return v, nil
+	case api.Percent:
+		return v > 0, nil
+	case uint8:
+		return v != 0, nil
+	default:
+		return false, fmt.Errorf("cannot tell whether cell %s is on from value %s", state.ID, state.Value)
+	}
+}
@@ -0,0 +1,90 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bartekpacia/fhome/api"
+	"github.com/bartekpacia/fhome/api/fhometest"
+)
+
+func TestTurnOnOff(t *testing.T) {
+	srv := fhometest.NewServer(t, fhometest.House{
+		Panels: []fhometest.Panel{
+			{ID: "1", Name: "House", Cells: []fhometest.Cell{
+				{ID: 300, Name: "Light", DisplayType: api.Percentage, Step: "0x6064", Value: "0x6064"},
+				{ID: 301, Name: "Lamp", DisplayType: api.Bit, Value: "0x0000"},
+				{ID: 302, Name: "Valve", TypeNumber: typeHeating, DisplayType: api.Percentage, Value: "0x6000"},
+				{ID: 303, Name: "Gate", TypeNumber: typeGate, DisplayType: api.Bit, Value: "0x0001"},
+				{ID: 305, Name: "Side gate", TypeNumber: typeGate, DisplayType: api.Byte, Value: "0x0000"},
+				{ID: 304, Name: "Heating", DisplayType: api.Temperature, Step: stepTemperatureSetter, Value: "0xa0fa"},
+			}},
+		},
+	})
+
+	client, apiConfig := srv.ConnectWithConfig(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	device := func(id int) Device {
+		cell, err := apiConfig.GetCellByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Classify(*cell)
+	}
+
+	tests := []struct {
+		id           int
+		on           bool
+		experimental bool
+		want         string // Value sent, or empty if none
+	}{
+		{id: 300, on: true, want: "0x6064"},
+		{id: 300, on: false, want: "0x6000"},
+		{id: 301, on: false, want: ""},
+		{id: 301, on: true, want: api.ValueToggle},
+		{id: 301, on: true, experimental: true, want: "0x0001"},
+		{id: 302, on: false, want: ""},
+		{id: 302, on: true, want: api.ValueToggle},
+	}
+
+	for _, tt := range tests {
+		before := len(srv.Events())
+
+		turn := TurnOff
+		if tt.on {
+			turn = TurnOn
+		}
+		if err := turn(ctx, client, device(tt.id), tt.experimental); err != nil {
+			t.Fatalf("cell %d on=%v: error = %v", tt.id, tt.on, err)
+		}
+
+		events := srv.Events()[before:]
+		switch {
+		case tt.want == "" && len(events) != 0:
+			t.Errorf("cell %d on=%v: sent %+v, want nothing", tt.id, tt.on, events)
+		case tt.want != "" && (len(events) != 1 || events[0].Value != tt.want):
+			t.Errorf("cell %d on=%v: sent %+v, want %s", tt.id, tt.on, events, tt.want)
+		}
+	}
+
+	// Gates are only controlled with an impulse.
+	for _, id := range []int{303, 305} {
+		before := len(srv.Events())
+		if err := TurnOff(ctx, client, device(id), true); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("TurnOff() of gate %d error = %v, want ErrUnsupported", id, err)
+		}
+		if events := srv.Events()[before:]; len(events) != 0 {
+			t.Errorf("TurnOff() of gate %d sent %+v, want nothing", id, events)
+		}
+	}
+
+	err := TurnOn(ctx, client, device(304), true)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("TurnOn() of a thermostat error = %v, want ErrUnsupported", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/bartekpacia/fhome/api"
 	"github.com/gorilla/websocket"
@@ -15,50 +16,133 @@ type Config struct {
 	Email            string
 	Password         string
 	ResourcePassword string
+
+	// URL of the F&Home API. If empty, [api.URL] is used.
+	URL string
+
+	// Unique ID or friendly name of the resource to connect to. If empty, the
+	// first resource of the user is used.
+	Resource string
+
+	// Whether to include cells that are not placed in any panel, see
+	// [api.IncludeUnassigned].
+	IncludeUnassigned bool
+
+	// Maximum duration of the whole handshake done by [Connect]. If zero,
+	// [DefaultHandshakeTimeout] is used.
+	HandshakeTimeout time.Duration
+
+	// How long the connection may stay silent before it's probed, see
+	// [api.KeepalivePolicy]. If zero, the default of [api.DefaultKeepalivePolicy]
+	// is used.
+	IdleTimeout time.Duration
+
+	// Whether apps may send values that are not confirmed with real devices,
+	// e.g. to blinds and RGB lights, see [devices.Unconfirmed].
+	Experimental bool
+}
+
+// DefaultHandshakeTimeout is the handshake timeout used by [Connect] if none is
+// configured.
+const DefaultHandshakeTimeout = 30 * time.Second
+
+// MergeOptions returns the options to pass to [GetConfigs] and
+// [api.MergeConfigs].
+func (c *Config) MergeOptions() []api.MergeOption {
+	var opts []api.MergeOption
+	if c.IncludeUnassigned {
+		opts = append(opts, api.IncludeUnassigned())
+	}
+
+	return opts
 }
 
 // Connect returns a client that is ready to use.
+//
+// The handshake fails if it takes longer than the handshake timeout of config
+// or if ctx is done. Once it succeeds, ctx no longer affects the client.
 func Connect(ctx context.Context, config *Config, dialer *websocket.Dialer) (*api.Client, error) {
-	client, err := api.NewClient(dialer)
+	timeout := config.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := []api.Option{api.WithStateHandler(logConnState)}
+	if config.URL != "" {
+		opts = append(opts, api.WithURL(config.URL))
+	}
+	if config.IdleTimeout > 0 {
+		keepalive := api.DefaultKeepalivePolicy
+		keepalive.IdleTimeout = config.IdleTimeout
+		opts = append(opts, api.WithKeepalive(&keepalive))
+	}
+
+	client, err := api.NewClient(ctx, dialer, opts...)
 	if err != nil {
 		slog.Error("failed to create API client", slog.Any("error", err))
 		return nil, fmt.Errorf("create fhome api client: %w", err)
 	}
 
-	slog.Debug("created API client")
+	slog.Debug("created API client", slog.String("url", config.URL))
+
+	err = openSessions(ctx, client, config)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
 
-	err = client.OpenCloudSession(config.Email, config.Password)
+// openSessions does the handshake of [Connect] on a new client.
+func openSessions(ctx context.Context, client *api.Client, config *Config) error {
+	err := client.OpenCloudSession(ctx, config.Email, config.Password)
 	if err != nil {
 		slog.Error("failed to open client session", slog.Any("error", err))
-		return nil, fmt.Errorf("open client session: %w", err)
+		return fmt.Errorf("open client session: %w", err)
 	}
 	slog.Debug("opened client session", slog.String("email", config.Email))
 
-	myResources, err := client.GetMyResources()
+	myResources, err := client.GetMyResources(ctx)
 	if err != nil {
 		slog.Error("failed to get resource", slog.Any("error", err))
-		return nil, fmt.Errorf("get my resources: %w", err)
+		return fmt.Errorf("get my resources: %w", err)
 	}
 
-	slog.Debug("got resource",
-		slog.String("name", myResources.FriendlyName0),
-		slog.String("id", myResources.UniqueID0),
-		slog.String("type", myResources.ResourceType0),
-	)
+	for _, resource := range myResources.Resources {
+		slog.Debug("got resource",
+			slog.String("name", resource.FriendlyName),
+			slog.String("id", resource.UniqueID),
+			slog.String("type", resource.ResourceType),
+		)
+	}
+
+	if config.Resource != "" {
+		resource, err := client.SelectResource(config.Resource)
+		if err != nil {
+			slog.Error("failed to select resource", slog.Any("error", err))
+			return fmt.Errorf("select resource: %w", err)
+		}
+
+		slog.Debug("selected resource", slog.String("name", resource.FriendlyName), slog.String("id", resource.UniqueID))
+	}
 
 	slog.Debug("opening client to resource session")
 	err = client.OpenResourceSession(ctx, config.ResourcePassword)
 	if err != nil {
 		slog.Error("failed to open client to resource session", slog.Any("error", err))
-		return nil, fmt.Errorf("open resource session: %w", err)
+		return fmt.Errorf("open resource session: %w", err)
 	}
 
 	slog.Debug("opened client to resource session")
 
-	return client, nil
+	return nil
 }
 
-func GetConfigs(ctx context.Context, fhomeClient *api.Client) (*api.Config, error) {
+func GetConfigs(ctx context.Context, fhomeClient *api.Client, opts ...api.MergeOption) (*api.Config, error) {
 	userConfig, err := fhomeClient.GetUserConfig(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get user config: %w", err)
@@ -77,10 +161,50 @@ func GetConfigs(ctx context.Context, fhomeClient *api.Client) (*api.Config, erro
 		slog.String("source", systemConfig.Source),
 	)
 
-	apiConfig, err := api.MergeConfigs(userConfig, systemConfig)
+	apiConfig, err := api.MergeConfigs(userConfig, systemConfig, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("merge configs: %w", err)
 	}
 
 	return apiConfig, nil
 }
+
+// GetConfigsWithState is like [GetConfigs], but also fills the values of cells
+// with their live state.
+func GetConfigsWithState(ctx context.Context, fhomeClient *api.Client, opts ...api.MergeOption) (*api.Config, error) {
+	apiConfig, err := GetConfigs(ctx, fhomeClient, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The state fetched while connecting saves a round trip.
+	var status *api.Status
+	if resp := fhomeClient.TakeSessionStatus(); resp != nil {
+		status, err = api.ParseStatus(resp)
+	} else {
+		status, err = fhomeClient.GetStatus(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get status: %w", err)
+	}
+	slog.Debug("got status",
+		slog.Int("cells", len(status.Cells)),
+		slog.String("project_version", status.ProjectVersion),
+	)
+
+	apiConfig.ApplyStatus(status)
+
+	return apiConfig, nil
+}
+
+// logConnState logs changes of the connection state of the client.
+func logConnState(state api.ConnState, err error) {
+	switch state {
+	case api.StateConnected:
+		slog.Info("reconnected to F&Home")
+	case api.StateDisconnected:
+		slog.Warn("disconnected from F&Home, reconnecting", slog.Any("error", err))
+	case api.StateClosed:
+		slog.Error("connection to F&Home closed", slog.Any("error", err))
+	}
+}
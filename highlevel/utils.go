@@ -9,9 +9,14 @@ import (
 
 // PrintCellData prints the values of its arguments into a JSON object.
 func PrintCellData(cellValue *api.CellValue, cfg *api.Config) error {
-	cell, err := cfg.GetCellByID(cellValue.IntID())
+	cellID, err := cellValue.ParseID()
 	if err != nil {
-		return fmt.Errorf("failed to get cell with ID %d: %v", cellValue.IntID(), err)
+		return fmt.Errorf("failed to parse cell ID: %w", err)
+	}
+
+	cell, err := cfg.GetCellByID(cellID)
+	if err != nil {
+		return fmt.Errorf("failed to get cell with ID %d: %w", cellID, err)
 	}
 
 	// Find panel ID of the cell
@@ -11,6 +11,7 @@ import (
 	"github.com/knadh/koanf/parsers/toml"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
+	"github.com/urfave/cli/v3"
 )
 
 // Load reads fhome configuration from well-known config file paths and environment variables.
@@ -43,5 +44,41 @@ func Load() *highlevel.Config {
 		Email:            k.MustString("FHOME_EMAIL"),
 		Password:         k.MustString("FHOME_CLOUD_PASSWORD"),
 		ResourcePassword: k.MustString("FHOME_RESOURCE_PASSWORD"),
+		URL:              k.String("FHOME_URL"),
+		Resource:         k.String("FHOME_RESOURCE"),
+
+		IncludeUnassigned: k.Bool("FHOME_UNASSIGNED"),
+		HandshakeTimeout:  k.Duration("FHOME_HANDSHAKE_TIMEOUT"),
+		IdleTimeout:       k.Duration("FHOME_IDLE_TIMEOUT"),
+		Experimental:      k.Bool("FHOME_EXPERIMENTAL"),
+	}
+}
+
+// ResourceFlag selects the resource to connect to. It overrides FHOME_RESOURCE.
+var ResourceFlag = &cli.StringFlag{
+	Name:  "resource",
+	Usage: "unique ID or name of the resource to connect to (overrides FHOME_RESOURCE)",
+}
+
+// UnassignedFlag includes cells that are not placed in any panel. It overrides
+// FHOME_UNASSIGNED.
+var UnassignedFlag = &cli.BoolFlag{
+	Name:  "unassigned",
+	Usage: "include objects that are not placed on any panel (overrides FHOME_UNASSIGNED)",
+}
+
+// LoadWithFlags is like [Load], but values of flags set on cmd override the
+// configuration.
+func LoadWithFlags(cmd *cli.Command) *highlevel.Config {
+	config := Load()
+
+	if resource := cmd.String(ResourceFlag.Name); resource != "" {
+		config.Resource = resource
 	}
+
+	if cmd.IsSet(UnassignedFlag.Name) {
+		config.IncludeUnassigned = cmd.Bool(UnassignedFlag.Name)
+	}
+
+	return config
 }